@@ -0,0 +1,185 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// Audit event types as stored in audit_events.event_type.
+const (
+	auditLoginSucceeded             = "login.succeeded"
+	auditLoginFailed                = "login.failed"
+	auditLoginLocked                = "login.locked"
+	auditCredentialsUpdated         = "user.credentials_updated"
+	auditPasswordReset              = "user.password_reset"
+	auditTwoFactorEnabled           = "user.two_factor_enabled"
+	auditTwoFactorDisabled          = "user.two_factor_disabled"
+	auditRefreshTokenRevoked        = "session.revoked"
+	auditOtherSessionsRevoked       = "session.revoked_others"
+	auditAllSessionsRevoked         = "session.revoked_all"
+	auditWebhookSubscriptionChanged = "webhook.subscription_changed"
+	auditAdminReset                 = "admin.reset"
+	auditAdminLoginUnlocked         = "admin.login_unlocked"
+	auditAdminUserRoleChanged       = "admin.user_role_changed"
+	auditChirpRemoved               = "moderation.chirp_removed"
+	auditChirpRestored              = "moderation.chirp_restored"
+	auditUserSuspended              = "moderation.user_suspended"
+	auditUserUnsuspended            = "moderation.user_unsuspended"
+)
+
+// auditEvent is one security-relevant action. ActorID is who did it and
+// SubjectID whose account it concerns; either is uuid.Nil when unknown.
+type auditEvent struct {
+	Type      string
+	ActorID   uuid.UUID
+	SubjectID uuid.UUID
+	Metadata  map[string]any
+}
+
+// recordAudit writes event to the audit log along with the request's client
+// IP, user agent and ID. A failed write is logged rather than failing the
+// request, which has usually already taken effect.
+func (cfg *apiConfig) recordAudit(r *http.Request, event auditEvent) {
+	err := writeAuditEvent(r, cfg.db, event)
+	if err != nil {
+		log.Printf("[%s] Couldn't record audit event %s: %s", requestIDFromContext(r.Context()), event.Type, err)
+	}
+}
+
+// writeAuditEvent is recordAudit through q. Pass a transaction's queries to
+// commit the event together with the change it records.
+func writeAuditEvent(r *http.Request, q *database.Queries, event auditEvent) error {
+	metadata := []byte("{}")
+	if event.Metadata != nil {
+		var err error
+		metadata, err = json.Marshal(event.Metadata)
+		if err != nil {
+			log.Printf("[%s] Couldn't encode audit metadata for %s: %s", requestIDFromContext(r.Context()), event.Type, err)
+			metadata = []byte("{}")
+		}
+	}
+
+	return q.CreateAuditEvent(r.Context(), database.CreateAuditEventParams{
+		EventType: event.Type,
+		ActorID:   uuid.NullUUID{UUID: event.ActorID, Valid: event.ActorID != uuid.Nil},
+		SubjectID: uuid.NullUUID{UUID: event.SubjectID, Valid: event.SubjectID != uuid.Nil},
+		IpAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: requestIDFromContext(r.Context()),
+		Metadata:  metadata,
+	})
+}
+
+type AuditEvent struct {
+	ID        uuid.UUID       `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Type      string          `json:"type"`
+	ActorID   *uuid.UUID      `json:"actor_id"`
+	SubjectID *uuid.UUID      `json:"subject_id"`
+	IPAddress string          `json:"ip_address"`
+	UserAgent string          `json:"user_agent"`
+	RequestID string          `json:"request_id"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+// Admin_ListAuditEventsHandler pages through the audit log, newest first.
+// It filters on type, actor_id, subject_id and an RFC 3339 since/until
+// range, and paginates like GET /api/chirps.
+func (cfg *apiConfig) Admin_ListAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := database.ListAuditEventsParams{}
+
+	if eventType := query.Get("type"); eventType != "" {
+		params.EventType = sql.NullString{String: eventType, Valid: true}
+	}
+
+	for name, dest := range map[string]*uuid.NullUUID{"actor_id": &params.ActorID, "subject_id": &params.SubjectID} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid "+name, err)
+			return
+		}
+		*dest = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	for name, dest := range map[string]*sql.NullTime{"since": &params.Since, "until": &params.Until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, name+" must be an RFC 3339 timestamp", err)
+			return
+		}
+		*dest = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+
+	limit, err := parsePageLimit(query)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+	// Fetch one extra row so we know whether there is a next page.
+	params.RowLimit = int32(limit + 1)
+
+	if cursorString := query.Get("cursor"); cursorString != "" {
+		cursor, err := decodeCursor(cursorString)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid cursor", err)
+			return
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	events, err := cfg.db.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch audit events", err)
+		return
+	}
+
+	nextCursor := ""
+	if len(events) > limit {
+		events = events[:limit]
+		last := events[len(events)-1]
+		nextCursor = encodeCursor(keysetCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	// Response initiated ---
+	eventResponses := []AuditEvent{}
+	for _, event := range events {
+		eventResponse := AuditEvent{
+			ID:        event.ID,
+			CreatedAt: event.CreatedAt,
+			Type:      event.EventType,
+			IPAddress: event.IpAddress,
+			UserAgent: event.UserAgent,
+			RequestID: event.RequestID,
+			Metadata:  event.Metadata,
+		}
+		if event.ActorID.Valid {
+			eventResponse.ActorID = &event.ActorID.UUID
+		}
+		if event.SubjectID.Valid {
+			eventResponse.SubjectID = &event.SubjectID.UUID
+		}
+		eventResponses = append(eventResponses, eventResponse)
+	}
+
+	if nextCursor != "" {
+		w.Header().Set("X-Next-Cursor", nextCursor)
+		w.Header().Set("Link", nextPageLink(r.URL, nextCursor))
+	}
+	respondWithJSON(w, http.StatusOK, eventResponses)
+}
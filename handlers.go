@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -8,12 +9,26 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"sort"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"githuv.com/grvbrk/go-server/internal/auth"
 	"githuv.com/grvbrk/go-server/internal/database"
+	"githuv.com/grvbrk/go-server/internal/subscription"
+)
+
+const refreshTokenTTL = time.Hour * 24 * 60
+
+const accessTokenTTL = time.Hour
+
+const (
+	polkaSignatureHeader = "X-Polka-Signature"
+	polkaTimestampHeader = "X-Polka-Timestamp"
+	// polkaSignatureTolerance is how far a webhook's timestamp may be from
+	// our clock before it is treated as a replay.
+	polkaSignatureTolerance = 5 * time.Minute
+	maxWebhookBodyBytes     = 64 << 10
 )
 
 type Chirp struct {
@@ -22,6 +37,101 @@ type Chirp struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body      string    `json:"body"`
 	UserID    uuid.UUID `json:"user_id"`
+	Edited    bool      `json:"edited"`
+	// InReplyTo is nil unless the chirp is a reply.
+	InReplyTo  *uuid.UUID `json:"in_reply_to"`
+	ReplyCount int64      `json:"reply_count"`
+	// Kind is post, rechirp or quote. A rechirp's body is empty.
+	Kind string `json:"kind"`
+	// ReferencedChirp is the chirp a rechirp or quote points at, one level
+	// deep. It is nil for posts and once the referenced chirp is deleted.
+	ReferencedChirp *Chirp `json:"referenced_chirp"`
+}
+
+// newChirp converts a chirp for a response without anything that needs
+// another query; use renderChirp for the full response.
+func newChirp(chirp database.Chirp) Chirp {
+	res := Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		Edited:    chirp.EditedAt.Valid,
+		Kind:      chirp.Kind,
+	}
+	if chirp.InReplyTo.Valid {
+		res.InReplyTo = &chirp.InReplyTo.UUID
+	}
+	return res
+}
+
+// renderChirps converts chirps for a response, embedding the chirps they
+// rechirp or quote and filling in reply counts, in at most two queries.
+// Pass a transaction's queries to see its writes.
+func renderChirps(ctx context.Context, q *database.Queries, chirps []database.Chirp) ([]Chirp, error) {
+	res := make([]Chirp, 0, len(chirps))
+	if len(chirps) == 0 {
+		return res, nil
+	}
+
+	referencedIDs := []uuid.UUID{}
+	for _, chirp := range chirps {
+		if referencedID := referencedChirpID(chirp); referencedID.Valid {
+			referencedIDs = append(referencedIDs, referencedID.UUID)
+		}
+	}
+
+	referenced := []database.Chirp{}
+	if len(referencedIDs) > 0 {
+		var err error
+		referenced, err = q.GetChirpsByIds(ctx, referencedIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps)+len(referenced))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	for _, chirp := range referenced {
+		ids = append(ids, chirp.ID)
+	}
+
+	counts, err := q.CountChirpReplies(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	replyCounts := make(map[uuid.UUID]int64, len(counts))
+	for _, count := range counts {
+		replyCounts[count.ChirpID] = count.ReplyCount
+	}
+
+	embeds := make(map[uuid.UUID]Chirp, len(referenced))
+	for _, chirp := range referenced {
+		embed := newChirp(chirp)
+		embed.ReplyCount = replyCounts[chirp.ID]
+		embeds[chirp.ID] = embed
+	}
+
+	for _, chirp := range chirps {
+		chirpResponse := newChirp(chirp)
+		chirpResponse.ReplyCount = replyCounts[chirp.ID]
+		if embed, ok := embeds[referencedChirpID(chirp).UUID]; ok {
+			chirpResponse.ReferencedChirp = &embed
+		}
+		res = append(res, chirpResponse)
+	}
+	return res, nil
+}
+
+func renderChirp(ctx context.Context, q *database.Queries, chirp database.Chirp) (Chirp, error) {
+	res, err := renderChirps(ctx, q, []database.Chirp{chirp})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return res[0], nil
 }
 
 func (cfg *apiConfig) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -30,6 +140,13 @@ func (cfg *apiConfig) HealthCheckHandler(w http.ResponseWriter, r *http.Request)
 	w.Write([]byte("OK"))
 }
 
+// JWKSHandler publishes the public keys access tokens can be verified with,
+// so other services never need the private key.
+func (cfg *apiConfig) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.jwt_keys.JWKS())
+}
+
 func (cfg *apiConfig) Admin_GetNumberOfHitsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
@@ -44,17 +161,22 @@ func (cfg *apiConfig) Admin_GetNumberOfHitsHandler(w http.ResponseWriter, r *htt
 
 func (cfg *apiConfig) Admin_ResetNumberOfHitsHandler(w http.ResponseWriter, r *http.Request) {
 	if cfg.platform != "dev" {
-		w.WriteHeader(http.StatusForbidden)
+		respondWithError(w, r, http.StatusForbidden, errCodeForbidden, "Reset is only allowed in dev environment", nil)
 		return
 	}
 
 	err := cfg.db.DeleteAllUsers(r.Context())
 	if err != nil {
-		log.Printf("Error Deleting all users: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't delete users", err)
 		return
 	}
 
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	cfg.recordAudit(r, auditEvent{
+		Type:    auditAdminReset,
+		ActorID: principal.UserID,
+	})
+
 	cfg.fileserverHits.Store(0)
 	w.WriteHeader(http.StatusOK)
 }
@@ -66,32 +188,29 @@ func (cfg *apiConfig) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	type resBodyStruct struct {
-		ID          uuid.UUID `json:"id"`
-		CreatedAt   time.Time `json:"created_at"`
-		UpdatedAt   time.Time `json:"updated_at"`
-		Email       string    `json:"email"`
-		IsChirpyRed bool      `json:"is_chirpy_red"`
+		ID            uuid.UUID `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+		IsChirpyRed   bool      `json:"is_chirpy_red"`
 	}
 
 	body := reqBodyStruct{}
-	reqBodyBytes, err := io.ReadAll(r.Body)
+	err := decodeJSONBody(r, &body)
 	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
 		return
 	}
 
-	err = json.Unmarshal(reqBodyBytes, &body)
-	if err != nil {
-		log.Printf("Error unmarshalling body: %s", err)
-		w.WriteHeader(500)
+	if !validEmail(body.Email) {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Email address is not valid", nil)
 		return
 	}
 
 	hashedPassword, err := auth.HashPassword(body.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't hash password", err)
 		return
 	}
 
@@ -100,196 +219,230 @@ func (cfg *apiConfig) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 		HashedPassword: hashedPassword,
 	})
 	if err != nil {
-		log.Printf("Error creating user: %s", err)
-		w.WriteHeader(500)
+		if isUniqueViolation(err) {
+			respondWithError(w, r, http.StatusConflict, errCodeEmailTaken, "Email is already registered", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't create user", err)
 		return
 	}
 
-	// Response initiated ---
-	resData := resBodyStruct{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
-	}
-
-	resDataJSON, err := json.Marshal(resData)
+	// The account exists either way; the user can ask for another email.
+	err = cfg.queueVerificationEmail(r.Context(), user.ID)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
-		return
+		log.Printf("[%s] Couldn't queue verification email: %s", requestIDFromContext(r.Context()), err)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(201)
-	w.Write(resDataJSON)
 
+	// Response initiated ---
+	respondWithJSON(w, http.StatusCreated, resBodyStruct{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		IsChirpyRed:   false,
+	})
 }
 
 func (cfg *apiConfig) CreateChirpHandler(w http.ResponseWriter, r *http.Request) {
 	type reqBodyStruct struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
+		QuoteOf   *uuid.UUID `json:"quote_of"`
 	}
 
-	type resBodyStruct struct {
-		ID        uuid.UUID `json:"id"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
-		Body      string    `json:"body"`
-		UserID    uuid.UUID `json:"user_id"`
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
 	}
 
-	// Check for access token
-	token, err := auth.GetBearerToken(r.Header)
+	body := reqBodyStruct{}
+	err := decodeJSONBody(r, &body)
 	if err != nil {
-		log.Printf("Error getting bearer/access token: %s", err)
-		w.WriteHeader(401)
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwt_secret)
+	user, err := cfg.db.GetUserByID(r.Context(), principal.UserID)
 	if err != nil {
-		log.Printf("Couldn't validate JWT: %s", err)
-		w.WriteHeader(401)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
 		return
 	}
 
-	body := reqBodyStruct{}
-	reqBodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
-		w.WriteHeader(500)
+	if user.SuspendedAt.Valid {
+		respondWithError(w, r, http.StatusForbidden, errCodeAccountSuspended, "Your account is suspended", nil)
 		return
 	}
 
-	err = json.Unmarshal(reqBodyBytes, &body)
-	if err != nil {
-		log.Printf("Error unmarshalling body: %s", err)
-		w.WriteHeader(500)
+	if cfg.require_email_verification && !user.EmailVerifiedAt.Valid {
+		respondWithError(w, r, http.StatusForbidden, errCodeEmailUnverified, "Verify your email before posting chirps", nil)
+		return
+	}
+
+	if body.InReplyTo != nil && body.QuoteOf != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "A chirp can't be both a reply and a quote", nil)
 		return
 	}
 
+	// Replying to or quoting a rechirp means the chirp it reposts.
+	inReplyTo := uuid.NullUUID{}
+	if body.InReplyTo != nil {
+		parent, err := resolveRechirp(r.Context(), cfg.db, *body.InReplyTo)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "The chirp being replied to doesn't exist", err)
+				return
+			}
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	kind := chirpKindPost
+	quoteOf := uuid.NullUUID{}
+	if body.QuoteOf != nil {
+		quoted, err := resolveRechirp(r.Context(), cfg.db, *body.QuoteOf)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "The chirp being quoted doesn't exist", err)
+				return
+			}
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+			return
+		}
+		kind = chirpKindQuote
+		quoteOf = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
+
 	chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		UserID: userID,
-		Body:   body.Body,
+		UserID:    principal.UserID,
+		Body:      body.Body,
+		InReplyTo: inReplyTo,
+		Kind:      kind,
+		QuoteOf:   quoteOf,
 	})
 	if err != nil {
-		log.Printf("Error unmarshalling body: %s", err)
-		w.WriteHeader(500)
+		if isUniqueViolation(err) {
+			respondWithError(w, r, http.StatusConflict, errCodeConflict, "You've already quoted this chirp with the same body", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't create chirp", err)
 		return
 	}
 
-	// Response initiated ---
-	resData := resBodyStruct{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	}
-
-	resDataJSON, err := json.Marshal(resData)
+	res, err := renderChirp(r.Context(), cfg.db, chirp)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(201)
-	w.Write(resDataJSON)
+	cfg.emitWebhookEvent(r, chirp.UserID, webhookEventChirpCreated, res)
 
+	// Response initiated ---
+	respondWithJSON(w, http.StatusCreated, res)
 }
 
 func (cfg *apiConfig) GetChirpsInAsc(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
 
-	chirps, err := cfg.db.GetAllChirpsInAsc(r.Context())
-	if err != nil {
-		log.Printf("Error fetching chirps: %s", err)
-		w.WriteHeader(500)
-		return
-	}
-
-	authorID := uuid.Nil
-	authorIDString := r.URL.Query().Get("author_id")
+	authorID := uuid.NullUUID{}
+	authorIDString := query.Get("author_id")
 	if authorIDString != "" {
-		authorID, err = uuid.Parse(authorIDString)
+		id, err := uuid.Parse(authorIDString)
 		if err != nil {
-			log.Printf("Invalid author ID: %s", err)
-			w.WriteHeader(400)
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid author ID", err)
 			return
 		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
 	}
 
-	sortParam := r.URL.Query().Get("sort")
+	limit, err := parsePageLimit(query)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error(), nil)
+		return
+	}
 
-	// Response initiated ---
-	chirpResponses := []Chirp{}
-	for _, chirp := range chirps {
-		if authorID != uuid.Nil && chirp.UserID != authorID {
-			continue
-		}
-		chirpResponse := Chirp{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if cursorString := query.Get("cursor"); cursorString != "" {
+		cursor, err := decodeCursor(cursorString)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid cursor", err)
+			return
 		}
-		chirpResponses = append(chirpResponses, chirpResponse)
+		cursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	// Fetch one extra row so we know whether there is a next page.
+	var chirps []database.Chirp
+	if query.Get("sort") == "desc" {
+		chirps, err = cfg.db.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(limit + 1),
+		})
+	} else {
+		chirps, err = cfg.db.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(limit + 1),
+		})
+	}
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirps", err)
+		return
 	}
 
-	sort.Slice(chirpResponses, func(i, j int) bool {
-		if sortParam == "desc" {
-			return chirpResponses[i].CreatedAt.After(chirpResponses[j].CreatedAt)
-		}
-		return chirpResponses[i].CreatedAt.Before(chirpResponses[j].CreatedAt)
-	})
+	nextCursor := ""
+	if len(chirps) > limit {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		nextCursor = encodeCursor(keysetCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
 
-	resDataJSON, err := json.Marshal(chirpResponses)
+	chirpResponses, err := renderChirps(r.Context(), cfg.db, chirps)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirps", err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(resDataJSON)
+	// Response initiated ---
+	if nextCursor != "" {
+		w.Header().Set("X-Next-Cursor", nextCursor)
+		w.Header().Set("Link", nextPageLink(r.URL, nextCursor))
+	}
+	respondWithJSON(w, http.StatusOK, chirpResponses)
 }
 
 func (cfg *apiConfig) GetChirpById(w http.ResponseWriter, r *http.Request) {
 	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		log.Printf("Error getting chirpID: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
 		return
 	}
 
 	chirp, err := cfg.db.GetChirpById(r.Context(), chirpId)
 	if err != nil {
-		log.Printf("Error fetching chirps: %s", err)
-		w.WriteHeader(404)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
 		return
 	}
 
-	resData := Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	}
-
-	resDataJSON, err := json.Marshal(resData)
+	res, err := renderChirp(r.Context(), cfg.db, chirp)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(resDataJSON)
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, res)
 }
 
 func (cfg *apiConfig) LoginUser(w http.ResponseWriter, r *http.Request) {
@@ -298,340 +451,638 @@ func (cfg *apiConfig) LoginUser(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
-	type resBodyStruct struct {
-		ID           uuid.UUID `json:"id"`
-		CreatedAt    time.Time `json:"created_at"`
-		UpdatedAt    time.Time `json:"updated_at"`
-		Email        string    `json:"email"`
-		Token        string    `json:"token"`
-		RefreshToken string    `json:"refresh_token"`
-		IsChirpyRed  bool      `json:"is_chirpy_red"`
+	type twoFactorResBodyStruct struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
 	}
 
 	body := reqBodyStruct{}
-	reqBodyBytes, err := io.ReadAll(r.Body)
+	err := decodeJSONBody(r, &body)
 	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
 		return
 	}
 
-	err = json.Unmarshal(reqBodyBytes, &body)
+	ip := clientIP(r)
+	wait, err := cfg.loginThrottle.Check(r.Context(), body.Email, ip)
 	if err != nil {
-		log.Printf("Error unmarshalling body: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't check login attempts", err)
+		return
+	}
+	if wait > 0 {
+		cfg.recordAudit(r, auditEvent{
+			Type:     auditLoginLocked,
+			Metadata: map[string]any{"email": body.Email, "retry_after_seconds": int(wait.Seconds())},
+		})
+		respondWithLoginLocked(w, r, wait)
 		return
 	}
 
+	// An unknown email must look exactly like a wrong password, so it is
+	// still checked against a hash and counted as a failure.
+	hashedPassword := dummyPasswordHash
 	user, err := cfg.db.GetUserByEmail(r.Context(), body.Email)
-	if err != nil {
-		log.Printf("Error finding user: %s", err)
-		w.WriteHeader(500)
+	if err == nil {
+		hashedPassword = user.HashedPassword
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
 		return
 	}
 
-	err = auth.CheckPasswordHash(body.Password, user.HashedPassword)
+	passwordErr := auth.CheckPasswordHash(body.Password, hashedPassword)
+	if err != nil || passwordErr != nil {
+		reason := "wrong_password"
+		if err != nil {
+			reason = "unknown_email"
+		}
+		cfg.recordAudit(r, auditEvent{
+			Type:      auditLoginFailed,
+			SubjectID: user.ID,
+			Metadata:  map[string]any{"email": body.Email, "reason": reason},
+		})
+
+		err = cfg.loginThrottle.RecordFailure(r.Context(), body.Email, ip)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record login attempt", err)
+			return
+		}
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Incorrect email or password", passwordErr)
+		return
+	}
+
+	if user.SuspendedAt.Valid {
+		cfg.recordAudit(r, auditEvent{
+			Type:      auditLoginFailed,
+			SubjectID: user.ID,
+			Metadata:  map[string]any{"email": body.Email, "reason": "suspended"},
+		})
+		respondWithError(w, r, http.StatusForbidden, errCodeAccountSuspended, "Your account is suspended", nil)
+		return
+	}
+
+	// With 2FA on, the password only earns a challenge token; the session is
+	// issued by LoginTwoFactorHandler once a code checks out. Failures are
+	// only cleared then, so wrong codes keep counting towards a lockout.
+	if user.TotpEnabledAt.Valid {
+		challengeToken, err := auth.MakeChallengeJWT(user.ID, cfg.jwt_keys, twoFactorChallengeTTL)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't create challenge token", err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, twoFactorResBodyStruct{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+		return
+	}
+
+	err = cfg.loginThrottle.RecordSuccess(r.Context(), body.Email)
 	if err != nil {
-		log.Printf("Unauthenticated User: %s", err)
-		w.WriteHeader(401)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record login attempt", err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(user.ID, cfg.jwt_secret, time.Hour)
+	cfg.respondWithNewSession(w, r, user)
+}
+
+// respondWithNewSession starts a session for an already authenticated user
+// and writes the login response.
+func (cfg *apiConfig) respondWithNewSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	type resBodyStruct struct {
+		ID            uuid.UUID `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Email         string    `json:"email"`
+		Token         string    `json:"token"`
+		RefreshToken  string    `json:"refresh_token"`
+		EmailVerified bool      `json:"email_verified"`
+		IsChirpyRed   bool      `json:"is_chirpy_red"`
+	}
+
+	// Each login starts a new session, identified by its refresh token family.
+	sessionID := uuid.New()
+
+	accessToken, err := auth.MakeSessionJWT(user.ID, sessionID, cfg.jwt_keys, accessTokenTTL)
 	if err != nil {
-		log.Printf("Unable to create access token: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't create access token", err)
 		return
 	}
 
 	refreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		log.Printf("Unable to create refresh token: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't create refresh token", err)
 		return
 	}
 
 	_, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
 		UserID:    user.ID,
-		Token:     refreshToken,
-		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
+		TokenHash: auth.HashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
+		FamilyID:  sessionID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
 	})
 	if err != nil {
-		log.Printf("Couldn't save refresh token: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't save refresh token", err)
 		return
 	}
 
-	// Response initiated ---
-	resData := resBodyStruct{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		Token:        accessToken,
-		RefreshToken: refreshToken,
-		IsChirpyRed:  user.IsChirpyRed,
-	}
-
-	resDataJSON, err := json.Marshal(resData)
+	isChirpyRed, err := cfg.db.IsChirpyRed(r.Context(), user.ID)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't look up subscription", err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(resDataJSON)
+
+	cfg.recordAudit(r, auditEvent{
+		Type:      auditLoginSucceeded,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"session_id": sessionID, "two_factor": user.TotpEnabledAt.Valid},
+	})
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, resBodyStruct{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Token:         accessToken,
+		RefreshToken:  refreshToken,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		IsChirpyRed:   isChirpyRed,
+	})
 }
 
 func (cfg *apiConfig) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	type resBodyStruct struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("Couldn't find token: %s", err)
-		w.WriteHeader(400)
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Couldn't find refresh token", err)
+		return
+	}
+
+	refreshTokenHash := auth.HashRefreshToken(refreshToken)
+	storedToken, err := cfg.db.GetRefreshToken(r.Context(), refreshTokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Refresh token is invalid or expired", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't look up refresh token", err)
+		return
+	}
+
+	switch checkRefreshToken(storedToken, time.Now().UTC()) {
+	case refreshTokenReused:
+		cfg.revokeRefreshTokenFamily(w, r, storedToken.UserID, storedToken.FamilyID)
+		return
+	case refreshTokenInvalid:
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Refresh token is invalid or expired", nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	_, err = qtx.RotateRefreshToken(r.Context(), refreshTokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Lost a race with another refresh of the same token.
+			tx.Rollback()
+			cfg.revokeRefreshTokenFamily(w, r, storedToken.UserID, storedToken.FamilyID)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't rotate refresh token", err)
 		return
 	}
 
-	user, err := cfg.db.GetUserFromRefreshToken(r.Context(), refreshToken)
+	newRefreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		log.Printf("Couldn't get user for refresh token: %s", err)
-		w.WriteHeader(401)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't create refresh token", err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwt_secret,
-		time.Hour,
+	_, err = qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(newRefreshToken),
+		UserID:    storedToken.UserID,
+		ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
+		FamilyID:  storedToken.FamilyID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't save refresh token", err)
+		return
+	}
+
+	accessToken, err := auth.MakeSessionJWT(
+		storedToken.UserID,
+		storedToken.FamilyID,
+		cfg.jwt_keys,
+		accessTokenTTL,
 	)
 	if err != nil {
-		log.Printf("Couldn't validate token: %s", err)
-		w.WriteHeader(401)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't create access token", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit refresh token rotation", err)
 		return
 	}
 
 	// Response initiated ---
-	resData := resBodyStruct{
-		Token: accessToken,
+	respondWithJSON(w, http.StatusOK, resBodyStruct{
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
+	})
+}
+
+func (cfg *apiConfig) revokeRefreshTokenFamily(w http.ResponseWriter, r *http.Request, userID, familyID uuid.UUID) {
+	err := cfg.db.RevokeRefreshTokenFamily(r.Context(), familyID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke refresh token family", err)
+		return
 	}
 
-	resDataJSON, err := json.Marshal(resData)
+	// The access tokens the family handed out may be in the same hands.
+	err = cfg.denylist.RevokeSession(r.Context(), userID, familyID)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke access tokens", err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(resDataJSON)
+	respondWithError(w, r, http.StatusUnauthorized, errCodeRefreshTokenReused, "Refresh token was already used; all sessions in this family have been revoked", nil)
+}
+
+type refreshTokenStatus string
+
+const (
+	refreshTokenUsable refreshTokenStatus = "usable"
+	// refreshTokenReused is a token that was already rotated being replayed.
+	// Either the client or an attacker holds a stolen copy, so every token in
+	// the family has to go.
+	refreshTokenReused  refreshTokenStatus = "reused"
+	refreshTokenInvalid refreshTokenStatus = "invalid"
+)
+
+// checkRefreshToken reports whether a stored refresh token can be rotated at
+// now. Reuse wins over revocation and expiry so a replayed token always
+// takes its family down with it.
+func checkRefreshToken(token database.RefreshToken, now time.Time) refreshTokenStatus {
+	if token.RotatedAt.Valid {
+		return refreshTokenReused
+	}
+	if token.RevokedAt.Valid || !token.ExpiresAt.After(now) {
+		return refreshTokenInvalid
+	}
+	return refreshTokenUsable
 }
 
 func (cfg *apiConfig) RefreshTokenRevokeHandler(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("Couldn't find token: %s", err)
-		w.WriteHeader(400)
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Couldn't find refresh token", err)
 		return
 	}
 
-	_, err = cfg.db.RevokeRefreshToken(r.Context(), refreshToken)
-
+	revokedToken, err := cfg.db.RevokeRefreshToken(r.Context(), auth.HashRefreshToken(refreshToken))
 	if err != nil {
-		log.Printf("Couldn't revoke session: %s", err)
-		w.WriteHeader(500)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Refresh token is invalid or already revoked", nil)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke session", err)
 		return
 	}
 
+	cfg.recordAudit(r, auditEvent{
+		Type:      auditRefreshTokenRevoked,
+		ActorID:   revokedToken.UserID,
+		SubjectID: revokedToken.UserID,
+		Metadata:  map[string]any{"session_id": revokedToken.FamilyID},
+	})
+
 	// Response initiated ---
-	w.WriteHeader(204)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (cfg *apiConfig) UpdateUserCredsHandler(w http.ResponseWriter, r *http.Request) {
 
 	type reqBodyStruct struct {
-		NewEmail    string `json:"email"`
-		NewPassword string `json:"password"`
+		CurrentPassword string `json:"current_password"`
+		NewEmail        string `json:"email"`
+		NewPassword     string `json:"password"`
 	}
 
 	type resBodyStruct struct {
-		ID          uuid.UUID `json:"id"`
-		CreatedAt   time.Time `json:"created_at"`
-		UpdatedAt   time.Time `json:"updated_at"`
-		Email       string    `json:"email"`
-		IsChirpyRed bool      `json:"is_chirpy_red"`
+		ID            uuid.UUID `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+		IsChirpyRed   bool      `json:"is_chirpy_red"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("Couldn't find JWT token: %s", err)
-		w.WriteHeader(401)
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwt_secret)
+	body := reqBodyStruct{}
+	err := decodeJSONBody(r, &body)
 	if err != nil {
-		log.Printf("Couldn't validate JWT: %s", err)
-		w.WriteHeader(401)
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
 		return
 	}
 
-	body := reqBodyStruct{}
-	reqBodyBytes, err := io.ReadAll(r.Body)
+	if !validEmail(body.NewEmail) {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Email address is not valid", nil)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(body.NewPassword)
 	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't hash password", err)
 		return
 	}
 
-	err = json.Unmarshal(reqBodyBytes, &body)
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
-		log.Printf("Error unmarshalling body: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 
-	hashedPassword, err := auth.HashPassword(body.NewPassword)
+	previous, err := qtx.GetUserByID(r.Context(), principal.UserID)
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
 		return
 	}
 
-	user, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             userID,
+	// An access token alone mustn't be enough to take over the account by
+	// changing its password or email.
+	if !cfg.reauthenticate(w, r, previous, body.CurrentPassword) {
+		return
+	}
+
+	user, err := qtx.UpdateUser(r.Context(), database.UpdateUserParams{
+		ID:             principal.UserID,
 		Email:          body.NewEmail,
 		HashedPassword: hashedPassword,
 	})
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
-		w.WriteHeader(500)
+		if isUniqueViolation(err) {
+			respondWithError(w, r, http.StatusConflict, errCodeEmailTaken, "Email is already registered", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't update user", err)
 		return
 	}
 
-	// Response initiated ---
-	resData := resBodyStruct{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+	// Tokens mailed to the old address must not verify the new one.
+	if previous.Email != user.Email {
+		err = qtx.InvalidateEmailVerificationTokensForUser(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't invalidate verification tokens", err)
+			return
+		}
 	}
 
-	resDataJSON, err := json.Marshal(resData)
+	err = tx.Commit()
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit user update", err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(resDataJSON)
-}
 
-func (cfg *apiConfig) DeleteChirpByIdHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.recordAudit(r, auditEvent{
+		Type:      auditCredentialsUpdated,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"email": user.Email},
+	})
 
-	token, err := auth.GetBearerToken(r.Header)
+	isChirpyRed, err := cfg.db.IsChirpyRed(r.Context(), user.ID)
 	if err != nil {
-		log.Printf("Couldn't find JWT token: %s", err)
-		w.WriteHeader(401)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't look up subscription", err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwt_secret)
-	if err != nil {
-		log.Printf("Couldn't validate JWT: %s", err)
-		w.WriteHeader(403)
+	cfg.emitWebhookEvent(r, user.ID, webhookEventUserUpdated, map[string]any{
+		"id":             user.ID,
+		"email":          user.Email,
+		"email_verified": user.EmailVerifiedAt.Valid,
+		"updated_at":     user.UpdatedAt,
+	})
+
+	// UpdateUser clears email_verified_at when the address changes, so this
+	// covers both new addresses and ones that were never confirmed.
+	if !user.EmailVerifiedAt.Valid {
+		err = cfg.queueVerificationEmail(r.Context(), user.ID)
+		if err != nil {
+			log.Printf("[%s] Couldn't queue verification email: %s", requestIDFromContext(r.Context()), err)
+		}
+	}
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, resBodyStruct{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		IsChirpyRed:   isChirpyRed,
+	})
+}
+
+func (cfg *apiConfig) DeleteChirpByIdHandler(w http.ResponseWriter, r *http.Request) {
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
 		return
 	}
 
 	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		log.Printf("Error getting chirpID: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
 		return
 	}
 
 	chirp, err := cfg.db.GetChirpById(r.Context(), chirpId)
 	if err != nil {
-		log.Printf("Couldn't find chirp for the given user: %s", err)
-		w.WriteHeader(404)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
 		return
 	}
 
-	if chirp.UserID != userID {
-		log.Printf("You can't delete this chirp: %s", err)
-		w.WriteHeader(403)
+	if chirp.UserID != principal.UserID {
+		respondWithError(w, r, http.StatusForbidden, errCodeForbidden, "You can't delete this chirp", nil)
 		return
 	}
 
-	err = cfg.db.DeleteChirpById(r.Context(), chirpId)
+	if chirp.Kind == chirpKindRechirp {
+		// A rechirp has nothing worth restoring, so deleting one undoes it.
+		_, err = cfg.db.DeleteRechirpForUser(r.Context(), database.DeleteRechirpForUserParams{
+			UserID:    principal.UserID,
+			RechirpOf: chirp.RechirpOf,
+		})
+	} else {
+		var deleted int64
+		deleted, err = cfg.db.SoftDeleteChirp(r.Context(), database.SoftDeleteChirpParams{
+			ID:        chirpId,
+			DeletedBy: uuid.NullUUID{UUID: principal.UserID, Valid: true},
+		})
+		if err == nil && deleted == 0 {
+			err = sql.ErrNoRows
+		}
+	}
 	if err != nil {
-		log.Printf("Error deleting chirp: %s", err)
-		w.WriteHeader(500)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted by a concurrent request.
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't delete chirp", err)
 		return
 	}
 
+	cfg.emitWebhookEvent(r, chirp.UserID, webhookEventChirpDeleted, map[string]any{"id": chirp.ID, "user_id": chirp.UserID})
+
 	// Response initiated ---
-	w.WriteHeader(204)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (cfg *apiConfig) WebhookHandler(w http.ResponseWriter, r *http.Request) {
 	type reqBodyStruct struct {
+		ID    string `json:"id"`
 		Event string `json:"event"`
 		Data  struct {
-			UserID uuid.UUID `json:"user_id"`
+			UserID    uuid.UUID `json:"user_id"`
+			PeriodEnd time.Time `json:"period_end"`
 		}
 	}
 
-	apiKey, err := auth.GetAPIKey(r.Header)
+	// The signature covers the exact bytes Polka sent, so read them before
+	// decoding.
+	rawBody, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
 	if err != nil {
-		log.Printf("Couldn't find api key: %s", err)
-		w.WriteHeader(401)
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Couldn't read request body", err)
 		return
 	}
 
-	if apiKey != cfg.polka_key {
-		log.Printf("API key is invalid: %s", err)
-		w.WriteHeader(401)
+	err = cfg.polka_verifier.Verify(
+		r.Header.Get(polkaSignatureHeader),
+		r.Header.Get(polkaTimestampHeader),
+		rawBody,
+	)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeInvalidSignature, "Webhook signature rejected: "+err.Error(), err)
 		return
 	}
 
 	body := reqBodyStruct{}
-	reqBodyBytes, err := io.ReadAll(r.Body)
+	err = json.Unmarshal(rawBody, &body)
 	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+		return
+	}
+
+	event := subscription.Event(body.Event)
+	if !subscription.KnownEvent(event) {
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	err = json.Unmarshal(reqBodyBytes, &body)
+	if body.ID == "" {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Event ID is required", nil)
+		return
+	}
+
+	// Polka retries deliveries it isn't sure about. Marking the event and
+	// applying it in one transaction means a retry is either a no-op or, if
+	// we crashed part way, a clean first attempt.
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
-		log.Printf("Error unmarshalling body: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 
-	if body.Event != "user.upgraded" {
-		w.WriteHeader(204)
+	marked, err := qtx.MarkWebhookEventProcessed(r.Context(), database.MarkWebhookEventProcessedParams{
+		Source:    "polka",
+		EventID:   body.ID,
+		EventType: body.Event,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record webhook event", err)
+		return
+	}
+
+	if marked == 0 {
+		// Already processed; acknowledge so Polka stops retrying.
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	_, err = cfg.db.UpgradeToChirpyRed(r.Context(), body.Data.UserID)
+	_, err = qtx.GetUserByID(r.Context(), body.Data.UserID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Printf("Couldn't find user: %s", err)
-			w.WriteHeader(404)
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Couldn't find user", err)
 			return
 		}
-		log.Printf("Couldn't update user: %s", err)
-		w.WriteHeader(500)
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't look up user", err)
+		return
+	}
+
+	next, changed, err := applySubscriptionEvent(r.Context(), qtx, body.Data.UserID, event, body.Data.PeriodEnd.UTC(), body.ID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't update subscription", err)
 		return
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit webhook event", err)
+		return
+	}
+
+	if changed {
+		cfg.recordAudit(r, auditEvent{
+			Type:      auditWebhookSubscriptionChanged,
+			SubjectID: body.Data.UserID,
+			Metadata: map[string]any{
+				"event":              body.Event,
+				"event_id":           body.ID,
+				"status":             next.Status,
+				"current_period_end": next.PeriodEnd,
+			},
+		})
+	}
+
 	// Response initiated ---
-	w.WriteHeader(204)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint
+// violation (SQLSTATE 23505).
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
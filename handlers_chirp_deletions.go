@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+)
+
+// chirpDeletionRetention is how long a deleted chirp can be restored before
+// the purge job removes it for good.
+const chirpDeletionRetention = 30 * 24 * time.Hour
+
+// chirpPurgeCutoff is the deletion time before which the purge job removes
+// chirps for good.
+func chirpPurgeCutoff(now time.Time) time.Time {
+	return now.Add(-chirpDeletionRetention)
+}
+
+// chirpRestorable reports whether a deleted chirp is still within
+// chirpDeletionRetention at now. A chirp past it may linger until the next
+// purge but is treated as gone.
+func chirpRestorable(deletedAt sql.NullTime, now time.Time) bool {
+	return deletedAt.Valid && deletedAt.Time.After(chirpPurgeCutoff(now))
+}
+
+// RestoreChirpHandler undoes an author's own deletion. Chirps removed by a
+// moderator can only be restored by a moderator.
+func (cfg *apiConfig) RestoreChirpHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
+		return
+	}
+
+	if user.SuspendedAt.Valid {
+		respondWithError(w, r, http.StatusForbidden, errCodeAccountSuspended, "Your account is suspended", nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := qtx.GetDeletedChirpForUpdate(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Deleted chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	if chirp.UserID != principal.UserID {
+		respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Deleted chirp not found", nil)
+		return
+	}
+
+	if chirp.DeletedBy.UUID != principal.UserID {
+		respondWithError(w, r, http.StatusForbidden, errCodeForbidden, "This chirp was removed by a moderator", nil)
+		return
+	}
+
+	if !chirpRestorable(chirp.DeletedAt, time.Now().UTC()) {
+		respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Deleted chirp not found", nil)
+		return
+	}
+
+	chirp, err = qtx.RestoreChirp(r.Context(), chirp.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, r, http.StatusConflict, errCodeConflict, "The same quote has been posted again since", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't restore chirp", err)
+		return
+	}
+
+	res, err := renderChirp(r.Context(), qtx, chirp)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit chirp restore", err)
+		return
+	}
+
+	cfg.emitWebhookEvent(r, chirp.UserID, webhookEventChirpRestored, res)
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestChirpRestorable(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	deletedAt := func(ago time.Duration) sql.NullTime {
+		return sql.NullTime{Time: now.Add(-ago), Valid: true}
+	}
+
+	tests := []struct {
+		name      string
+		deletedAt sql.NullTime
+		want      bool
+	}{
+		{name: "Not deleted", deletedAt: sql.NullTime{}, want: false},
+		{name: "Just deleted", deletedAt: deletedAt(0), want: true},
+		{name: "Deleted a week ago", deletedAt: deletedAt(7 * 24 * time.Hour), want: true},
+		{name: "Retention almost over", deletedAt: deletedAt(chirpDeletionRetention - time.Second), want: true},
+		{name: "Retention over", deletedAt: deletedAt(chirpDeletionRetention), want: false},
+		{name: "Awaiting purge", deletedAt: deletedAt(chirpDeletionRetention + time.Hour), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chirpRestorable(tt.deletedAt, now); got != tt.want {
+				t.Errorf("chirpRestorable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The purge job deletes rows with deleted_at before the cutoff. None of them
+// may still be restorable, or a restore could race the purge.
+func TestChirpPurgeCutoff(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cutoff := chirpPurgeCutoff(now)
+
+	if want := now.Add(-30 * 24 * time.Hour); !cutoff.Equal(want) {
+		t.Fatalf("chirpPurgeCutoff() = %v, want %v", cutoff, want)
+	}
+
+	for _, offset := range []time.Duration{-time.Hour, -time.Microsecond, 0, time.Microsecond, time.Hour} {
+		deletedAt := sql.NullTime{Time: cutoff.Add(offset), Valid: true}
+		purged := deletedAt.Time.Before(cutoff)
+		if purged && chirpRestorable(deletedAt, now) {
+			t.Errorf("chirp deleted at cutoff%+v is purged but still restorable", offset)
+		}
+	}
+}
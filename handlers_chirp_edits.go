@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// defaultChirpEditWindow is used when CHIRP_EDIT_WINDOW isn't set.
+const defaultChirpEditWindow = 15 * time.Minute
+
+// chirpEditable reports whether a chirp posted at createdAt can still be
+// edited at now. The window runs from posting, so edits don't extend it.
+func chirpEditable(createdAt time.Time, window time.Duration, now time.Time) bool {
+	return now.Sub(createdAt) <= window
+}
+
+// ChirpRevision is a body a chirp had before it was edited.
+type ChirpRevision struct {
+	Body       string    `json:"body"`
+	WrittenAt  time.Time `json:"written_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// UpdateChirpHandler lets the author change a chirp's body within
+// chirpEditWindow of posting it. The old body is kept in chirp_revisions.
+func (cfg *apiConfig) UpdateChirpHandler(w http.ResponseWriter, r *http.Request) {
+	type reqBodyStruct struct {
+		Body string `json:"body"`
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	body := reqBodyStruct{}
+	err = decodeJSONBody(r, &body)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
+		return
+	}
+
+	if user.SuspendedAt.Valid {
+		respondWithError(w, r, http.StatusForbidden, errCodeAccountSuspended, "Your account is suspended", nil)
+		return
+	}
+
+	if cfg.require_email_verification && !user.EmailVerifiedAt.Valid {
+		respondWithError(w, r, http.StatusForbidden, errCodeEmailUnverified, "Verify your email before editing chirps", nil)
+		return
+	}
+
+	// Lock the chirp so two edits can't both save the same prior body.
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := qtx.GetChirpByIdForUpdate(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	if chirp.UserID != principal.UserID {
+		respondWithError(w, r, http.StatusForbidden, errCodeForbidden, "You can't edit this chirp", nil)
+		return
+	}
+
+	if chirp.Kind == chirpKindRechirp {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Rechirps have no body to edit", nil)
+		return
+	}
+
+	if !chirpEditable(chirp.CreatedAt, cfg.chirpEditWindow, time.Now().UTC()) {
+		respondWithError(w, r, http.StatusForbidden, errCodeEditWindowClosed, "Chirps can only be edited for "+cfg.chirpEditWindow.String()+" after posting", nil)
+		return
+	}
+
+	if body.Body == chirp.Body {
+		res, err := renderChirp(r.Context(), qtx, chirp)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+			return
+		}
+
+		// Response initiated ---
+		respondWithJSON(w, http.StatusOK, res)
+		return
+	}
+
+	writtenAt := chirp.CreatedAt
+	if chirp.EditedAt.Valid {
+		writtenAt = chirp.EditedAt.Time
+	}
+	err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+		ChirpID:   chirp.ID,
+		Body:      chirp.Body,
+		WrittenAt: writtenAt,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't save revision", err)
+		return
+	}
+
+	chirp, err = qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   chirp.ID,
+		Body: body.Body,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, r, http.StatusConflict, errCodeConflict, "You've already quoted this chirp with the same body", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't update chirp", err)
+		return
+	}
+
+	res, err := renderChirp(r.Context(), qtx, chirp)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit chirp edit", err)
+		return
+	}
+
+	cfg.emitWebhookEvent(r, chirp.UserID, webhookEventChirpUpdated, res)
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// GetChirpHistoryHandler returns a chirp's previous bodies, most recently
+// replaced first. The current body is on the chirp itself.
+func (cfg *apiConfig) GetChirpHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	_, err = cfg.db.GetChirpById(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	revisions, err := cfg.db.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp history", err)
+		return
+	}
+
+	// Response initiated ---
+	revisionResponses := []ChirpRevision{}
+	for _, revision := range revisions {
+		revisionResponses = append(revisionResponses, ChirpRevision{
+			Body:       revision.Body,
+			WrittenAt:  revision.WrittenAt,
+			ReplacedAt: revision.ReplacedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, revisionResponses)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChirpEditable(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		window    time.Duration
+		want      bool
+	}{
+		{name: "Just posted", createdAt: now, window: defaultChirpEditWindow, want: true},
+		{name: "Inside window", createdAt: now.Add(-10 * time.Minute), window: defaultChirpEditWindow, want: true},
+		{name: "Window just closing", createdAt: now.Add(-defaultChirpEditWindow), window: defaultChirpEditWindow, want: true},
+		{name: "Window closed", createdAt: now.Add(-defaultChirpEditWindow - time.Millisecond), window: defaultChirpEditWindow, want: false},
+		{name: "Long window", createdAt: now.Add(-2 * time.Hour), window: 24 * time.Hour, want: true},
+		{name: "Zero window", createdAt: now.Add(-time.Second), window: 0, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chirpEditable(tt.createdAt, tt.window, now); got != tt.want {
+				t.Errorf("chirpEditable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
+	// maxThreadReplies caps how many replies one thread response carries.
+	// Deeper levels are dropped first.
+	maxThreadReplies = 200
+)
+
+// ChirpThreadNode is a chirp in a thread with the replies to it that fit in
+// the response.
+type ChirpThreadNode struct {
+	Chirp
+	Replies []*ChirpThreadNode `json:"replies"`
+}
+
+type ChirpThread struct {
+	// Ancestors is the chain of chirps being replied to, root first.
+	Ancestors []Chirp          `json:"ancestors"`
+	Chirp     *ChirpThreadNode `json:"chirp"`
+	// Truncated is set when replies were left out to stay under
+	// maxThreadReplies. reply_count on each chirp is always complete.
+	Truncated bool `json:"truncated"`
+}
+
+// GetChirpRepliesHandler pages through the direct replies to a chirp, oldest
+// first.
+func (cfg *apiConfig) GetChirpRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	limit, err := parsePageLimit(query)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+
+	params := database.ListChirpRepliesParams{
+		ParentID: chirpID,
+		RowLimit: int32(limit + 1),
+	}
+	if cursorString := query.Get("cursor"); cursorString != "" {
+		cursor, err := decodeCursor(cursorString)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid cursor", err)
+			return
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	_, err = cfg.db.GetChirpById(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	replies, err := cfg.db.ListChirpReplies(r.Context(), params)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch replies", err)
+		return
+	}
+
+	nextCursor := ""
+	if len(replies) > limit {
+		replies = replies[:limit]
+		last := replies[len(replies)-1]
+		nextCursor = encodeCursor(keysetCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	chirpResponses, err := renderChirps(r.Context(), cfg.db, replies)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch replies", err)
+		return
+	}
+
+	// Response initiated ---
+	if nextCursor != "" {
+		w.Header().Set("X-Next-Cursor", nextCursor)
+		w.Header().Set("Link", nextPageLink(r.URL, nextCursor))
+	}
+	respondWithJSON(w, http.StatusOK, chirpResponses)
+}
+
+// GetChirpThreadHandler returns a chirp with everything it replies to and
+// the replies under it, ?depth= levels deep.
+func (cfg *apiConfig) GetChirpThreadHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	depth := defaultThreadDepth
+	if depthString := r.URL.Query().Get("depth"); depthString != "" {
+		depth, err = strconv.Atoi(depthString)
+		if err != nil || depth < 1 || depth > maxThreadDepth {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "depth must be between 1 and "+strconv.Itoa(maxThreadDepth), nil)
+			return
+		}
+	}
+
+	chirp, err := cfg.db.GetChirpById(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	ancestors, err := cfg.db.ListChirpAncestors(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch thread", err)
+		return
+	}
+
+	descendants, err := cfg.db.ListChirpDescendants(r.Context(), database.ListChirpDescendantsParams{
+		RootID:   chirpID,
+		MaxDepth: int32(depth),
+		RowLimit: maxThreadReplies + 1,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch thread", err)
+		return
+	}
+
+	descendants, truncated := truncateThread(descendants)
+
+	// One round trip for every reply count in the thread.
+	all := make([]database.Chirp, 0, len(ancestors)+1+len(descendants))
+	all = append(all, ancestors...)
+	all = append(all, chirp)
+	all = append(all, descendants...)
+	rendered, err := renderChirps(r.Context(), cfg.db, all)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch thread", err)
+		return
+	}
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, ChirpThread{
+		Ancestors: rendered[:len(ancestors)],
+		Chirp:     buildThreadTree(rendered[len(ancestors)], rendered[len(ancestors)+1:]),
+		Truncated: truncated,
+	})
+}
+
+// truncateThread caps descendants at maxThreadReplies and reports whether
+// any were dropped. They come a level at a time, so the deepest go first.
+func truncateThread(descendants []database.Chirp) ([]database.Chirp, bool) {
+	if len(descendants) > maxThreadReplies {
+		return descendants[:maxThreadReplies], true
+	}
+	return descendants, false
+}
+
+// buildThreadTree nests replies under root. Replies come a level at a time,
+// so every reply's parent is already in the tree when it is reached.
+func buildThreadTree(root Chirp, replies []Chirp) *ChirpThreadNode {
+	rootNode := &ChirpThreadNode{Chirp: root, Replies: []*ChirpThreadNode{}}
+	nodes := map[uuid.UUID]*ChirpThreadNode{root.ID: rootNode}
+	for _, reply := range replies {
+		node := &ChirpThreadNode{Chirp: reply, Replies: []*ChirpThreadNode{}}
+		parent := nodes[*reply.InReplyTo]
+		parent.Replies = append(parent.Replies, node)
+		nodes[reply.ID] = node
+	}
+	return rootNode
+}
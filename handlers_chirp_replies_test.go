@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+func TestBuildThreadTree(t *testing.T) {
+	ids := map[string]uuid.UUID{}
+	names := map[uuid.UUID]string{}
+	for _, name := range []string{"root", "a", "b", "c", "d", "e"} {
+		ids[name] = uuid.New()
+		names[ids[name]] = name
+	}
+	reply := func(name, parent string) Chirp {
+		parentID := ids[parent]
+		return Chirp{ID: ids[name], InReplyTo: &parentID}
+	}
+
+	tests := []struct {
+		name    string
+		replies []Chirp
+		want    string
+	}{
+		{
+			name: "No replies",
+			want: "root",
+		},
+		{
+			name:    "Direct replies keep their order",
+			replies: []Chirp{reply("a", "root"), reply("b", "root")},
+			want:    "root(a,b)",
+		},
+		{
+			name:    "Chain",
+			replies: []Chirp{reply("a", "root"), reply("b", "a"), reply("c", "b")},
+			want:    "root(a(b(c)))",
+		},
+		{
+			name: "Levels interleave",
+			replies: []Chirp{
+				reply("a", "root"), reply("b", "root"),
+				reply("c", "b"), reply("d", "a"), reply("e", "b"),
+			},
+			want: "root(a(d),b(c,e))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := buildThreadTree(Chirp{ID: ids["root"]}, tt.replies)
+			if got := threadShape(tree, names); got != tt.want {
+				t.Errorf("buildThreadTree() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// threadShape draws a thread as name(reply,reply(...)).
+func threadShape(node *ChirpThreadNode, names map[uuid.UUID]string) string {
+	if node.Replies == nil {
+		return names[node.ID] + "<nil replies>"
+	}
+	if len(node.Replies) == 0 {
+		return names[node.ID]
+	}
+	replies := make([]string, 0, len(node.Replies))
+	for _, reply := range node.Replies {
+		replies = append(replies, threadShape(reply, names))
+	}
+	return names[node.ID] + "(" + strings.Join(replies, ",") + ")"
+}
+
+func TestTruncateThread(t *testing.T) {
+	tests := []struct {
+		name          string
+		count         int
+		wantCount     int
+		wantTruncated bool
+	}{
+		{name: "Empty", count: 0, wantCount: 0},
+		{name: "Under the cap", count: 10, wantCount: 10},
+		{name: "At the cap", count: maxThreadReplies, wantCount: maxThreadReplies},
+		{name: "Over the cap", count: maxThreadReplies + 1, wantCount: maxThreadReplies, wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			descendants := make([]database.Chirp, tt.count)
+			for i := range descendants {
+				descendants[i].ID = uuid.New()
+			}
+
+			got, truncated := truncateThread(descendants)
+			if len(got) != tt.wantCount || truncated != tt.wantTruncated {
+				t.Fatalf("truncateThread() = %d replies, truncated %v, want %d, %v", len(got), truncated, tt.wantCount, tt.wantTruncated)
+			}
+			// The deepest replies are last, so those are the ones dropped.
+			for i := range got {
+				if got[i].ID != descendants[i].ID {
+					t.Fatalf("truncateThread() reordered replies at %d", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+	"githuv.com/grvbrk/go-server/internal/jobs"
+	"githuv.com/grvbrk/go-server/internal/mailer"
+)
+
+const emailVerificationTokenTTL = time.Hour * 24
+
+// validEmail accepts a bare address such as "user@example.com", rejecting
+// display names and anything net/mail can't parse.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// queueVerificationEmail sends the verification email from a background
+// job. The job issues the token itself so it never sits in the jobs table.
+func (cfg *apiConfig) queueVerificationEmail(ctx context.Context, userID uuid.UUID) error {
+	_, err := cfg.jobs.Enqueue(ctx, jobSendVerificationEmail, userJob{UserID: userID}, jobs.Options{})
+	return err
+}
+
+// sendVerificationEmail issues a fresh verification token for user and mails
+// it to their current address.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	verificationToken, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(verificationToken),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email",
+		Body: fmt.Sprintf(`Welcome to Chirpy! Confirm this is your email address by opening:
+
+%s/api/users/verify?token=%s
+
+The link expires in %s.`,
+			cfg.base_url, verificationToken, emailVerificationTokenTTL),
+	})
+}
+
+// VerifyEmailHandler accepts the token either as a `token` query param (GET,
+// so the emailed link works) or in a JSON body (POST).
+func (cfg *apiConfig) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	type reqBodyStruct struct {
+		Token string `json:"token"`
+	}
+
+	type resBodyStruct struct {
+		ID            uuid.UUID `json:"id"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+	}
+
+	body := reqBodyStruct{}
+	if r.Method == http.MethodGet {
+		body.Token = r.URL.Query().Get("token")
+	} else {
+		err := decodeJSONBody(r, &body)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+			return
+		}
+	}
+
+	if body.Token == "" {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Token is required", nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	verificationToken, err := qtx.ConsumeEmailVerificationToken(r.Context(), auth.HashToken(body.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidToken, "Verification token is invalid, expired or already used", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't look up verification token", err)
+		return
+	}
+
+	user, err := qtx.MarkEmailVerified(r.Context(), verificationToken.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't verify email", err)
+		return
+	}
+
+	err = qtx.InvalidateEmailVerificationTokensForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't invalidate verification tokens", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit email verification", err)
+		return
+	}
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, resBodyStruct{
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	})
+}
+
+func (cfg *apiConfig) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, r, http.StatusConflict, errCodeAlreadyVerified, "Email is already verified", nil)
+		return
+	}
+
+	err = cfg.queueVerificationEmail(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't queue verification email", err)
+		return
+	}
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusAccepted)
+}
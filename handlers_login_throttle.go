@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+	"githuv.com/grvbrk/go-server/internal/loginthrottle"
+)
+
+var (
+	accountLoginPolicy = loginthrottle.Policy{
+		FreeAttempts: 5,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		ResetAfter:   time.Hour,
+	}
+	// One IP may be trying many accounts, so it gets more room before the
+	// lockouts start.
+	ipLoginPolicy = loginthrottle.Policy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		ResetAfter:   time.Hour,
+	}
+)
+
+// dummyPasswordHash is checked against when the email is unknown, so that
+// answering takes as long as it does for a wrong password.
+var dummyPasswordHash, _ = auth.HashPassword("not-a-real-password")
+
+func respondWithLoginLocked(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, r, http.StatusTooManyRequests, errCodeTooManyAttempts, "Too many failed login attempts, try again later", nil)
+}
+
+// reauthenticate checks password against the signed-in user's own before a
+// sensitive account change. Wrong passwords count against the same lockouts
+// as failed logins, so an access token can't be used to guess the password.
+// It writes the error response itself and reports whether to go on.
+func (cfg *apiConfig) reauthenticate(w http.ResponseWriter, r *http.Request, user database.User, password string) bool {
+	ip := clientIP(r)
+	wait, err := cfg.loginThrottle.Check(r.Context(), user.Email, ip)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't check login attempts", err)
+		return false
+	}
+	if wait > 0 {
+		respondWithLoginLocked(w, r, wait)
+		return false
+	}
+
+	passwordErr := auth.CheckPasswordHash(password, user.HashedPassword)
+	if passwordErr != nil {
+		err = cfg.loginThrottle.RecordFailure(r.Context(), user.Email, ip)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record login attempt", err)
+			return false
+		}
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Incorrect password", passwordErr)
+		return false
+	}
+	return true
+}
+
+// Admin_UnlockLoginHandler clears the failed login count and any lockout for
+// an email, an IP, or both.
+func (cfg *apiConfig) Admin_UnlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	type reqBodyStruct struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+
+	type resBodyStruct struct {
+		Unlocked bool `json:"unlocked"`
+	}
+
+	body := reqBodyStruct{}
+	err := decodeJSONBody(r, &body)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+		return
+	}
+
+	if body.Email == "" && body.IP == "" {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Email or IP is required", nil)
+		return
+	}
+
+	unlocked := false
+	if body.Email != "" {
+		ok, err := cfg.loginThrottle.Unlock(r.Context(), loginthrottle.ScopeAccount, body.Email)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't unlock account", err)
+			return
+		}
+		unlocked = unlocked || ok
+	}
+	if body.IP != "" {
+		ok, err := cfg.loginThrottle.Unlock(r.Context(), loginthrottle.ScopeIP, body.IP)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't unlock IP", err)
+			return
+		}
+		unlocked = unlocked || ok
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	cfg.recordAudit(r, auditEvent{
+		Type:     auditAdminLoginUnlocked,
+		ActorID:  principal.UserID,
+		Metadata: map[string]any{"email": body.Email, "ip": body.IP, "unlocked": unlocked},
+	})
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, resBodyStruct{Unlocked: unlocked})
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// Moderation actions as recorded in moderation_actions.action.
+const (
+	moderationActionRemoveChirp   = "remove_chirp"
+	moderationActionRestoreChirp  = "restore_chirp"
+	moderationActionSuspendUser   = "suspend_user"
+	moderationActionUnsuspendUser = "unsuspend_user"
+)
+
+const maxModerationReasonLength = 500
+
+type ModerationAction struct {
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ModeratorID   *uuid.UUID `json:"moderator_id"`
+	Action        string     `json:"action"`
+	TargetUserID  *uuid.UUID `json:"target_user_id"`
+	TargetChirpID *uuid.UUID `json:"target_chirp_id"`
+	ChirpBody     *string    `json:"chirp_body"`
+	Reason        string     `json:"reason"`
+}
+
+// ModeratedChirp is a chirp as moderators see it, including whether and by
+// whom it was deleted.
+type ModeratedChirp struct {
+	Chirp
+	DeletedAt *time.Time `json:"deleted_at"`
+	DeletedBy *uuid.UUID `json:"deleted_by"`
+}
+
+func moderationActionResponse(action database.ModerationAction) ModerationAction {
+	res := ModerationAction{
+		ID:        action.ID,
+		CreatedAt: action.CreatedAt,
+		Action:    action.Action,
+		Reason:    action.Reason,
+	}
+	if action.ModeratorID.Valid {
+		res.ModeratorID = &action.ModeratorID.UUID
+	}
+	if action.TargetUserID.Valid {
+		res.TargetUserID = &action.TargetUserID.UUID
+	}
+	if action.TargetChirpID.Valid {
+		res.TargetChirpID = &action.TargetChirpID.UUID
+	}
+	if action.ChirpBody.Valid {
+		res.ChirpBody = &action.ChirpBody.String
+	}
+	return res
+}
+
+// decodeModerationReason reads the {"reason": "..."} body every moderation
+// action requires.
+func decodeModerationReason(r *http.Request) (string, error) {
+	type reqBodyStruct struct {
+		Reason string `json:"reason"`
+	}
+
+	body := reqBodyStruct{}
+	err := decodeJSONBody(r, &body)
+	if err != nil {
+		return "", err
+	}
+
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" {
+		return "", errors.New("reason is required")
+	}
+	if len(reason) > maxModerationReasonLength {
+		return "", errors.New("reason is too long")
+	}
+	return reason, nil
+}
+
+// Moderator_RemoveChirpHandler deletes any chirp. The removed body is kept in
+// the moderation log, and only a moderator can restore it.
+func (cfg *apiConfig) Moderator_RemoveChirpHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	reason, err := decodeModerationReason(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "A reason of up to 500 characters is required", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := qtx.GetChirpById(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	_, err = qtx.SoftDeleteChirp(r.Context(), database.SoftDeleteChirpParams{
+		ID:        chirpID,
+		DeletedBy: uuid.NullUUID{UUID: principal.UserID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't delete chirp", err)
+		return
+	}
+
+	_, err = qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:   uuid.NullUUID{UUID: principal.UserID, Valid: true},
+		Action:        moderationActionRemoveChirp,
+		TargetUserID:  uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+		TargetChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		ChirpBody:     sql.NullString{String: chirp.Body, Valid: true},
+		Reason:        reason,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record moderation action", err)
+		return
+	}
+
+	err = writeAuditEvent(r, qtx, auditEvent{
+		Type:      auditChirpRemoved,
+		ActorID:   principal.UserID,
+		SubjectID: chirp.UserID,
+		Metadata:  map[string]any{"chirp_id": chirp.ID, "reason": reason},
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record audit event", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit chirp removal", err)
+		return
+	}
+
+	cfg.emitWebhookEvent(r, chirp.UserID, webhookEventChirpDeleted, map[string]any{"id": chirp.ID, "user_id": chirp.UserID, "removed_by_moderator": true})
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Moderator_RestoreChirpHandler brings back any deleted chirp that hasn't
+// passed chirpDeletionRetention, whoever deleted it.
+func (cfg *apiConfig) Moderator_RestoreChirpHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	reason, err := decodeModerationReason(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "A reason of up to 500 characters is required", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := qtx.GetDeletedChirpForUpdate(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Deleted chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	if !chirpRestorable(chirp.DeletedAt, time.Now().UTC()) {
+		respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Deleted chirp not found", nil)
+		return
+	}
+
+	chirp, err = qtx.RestoreChirp(r.Context(), chirp.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, r, http.StatusConflict, errCodeConflict, "The same quote has been posted again since", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't restore chirp", err)
+		return
+	}
+
+	_, err = qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:   uuid.NullUUID{UUID: principal.UserID, Valid: true},
+		Action:        moderationActionRestoreChirp,
+		TargetUserID:  uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+		TargetChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		Reason:        reason,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record moderation action", err)
+		return
+	}
+
+	err = writeAuditEvent(r, qtx, auditEvent{
+		Type:      auditChirpRestored,
+		ActorID:   principal.UserID,
+		SubjectID: chirp.UserID,
+		Metadata:  map[string]any{"chirp_id": chirp.ID, "reason": reason},
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record audit event", err)
+		return
+	}
+
+	res, err := renderChirp(r.Context(), qtx, chirp)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit chirp restore", err)
+		return
+	}
+
+	cfg.emitWebhookEvent(r, chirp.UserID, webhookEventChirpRestored, res)
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// Moderator_SuspendUserHandler stops a user from logging in or posting and
+// ends all of their sessions.
+func (cfg *apiConfig) Moderator_SuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserSuspended(w, r, true)
+}
+
+func (cfg *apiConfig) Moderator_UnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserSuspended(w, r, false)
+}
+
+func (cfg *apiConfig) setUserSuspended(w http.ResponseWriter, r *http.Request, suspended bool) {
+	type resBodyStruct struct {
+		ID          uuid.UUID  `json:"id"`
+		Email       string     `json:"email"`
+		SuspendedAt *time.Time `json:"suspended_at"`
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid user ID", err)
+		return
+	}
+
+	if userID == principal.UserID {
+		respondWithError(w, r, http.StatusForbidden, errCodeForbidden, "You can't change your own suspension", nil)
+		return
+	}
+
+	reason, err := decodeModerationReason(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "A reason of up to 500 characters is required", err)
+		return
+	}
+
+	moderator, err := cfg.db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find moderator", err)
+		return
+	}
+
+	target, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Couldn't find user", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
+		return
+	}
+
+	// Nobody can moderate someone with the same role or a higher one.
+	if auth.Role(target.Role).Includes(auth.Role(moderator.Role)) {
+		respondWithError(w, r, http.StatusForbidden, errCodeForbidden, "You can't moderate this user", nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	action, auditType := moderationActionUnsuspendUser, auditUserUnsuspended
+	if suspended {
+		action, auditType = moderationActionSuspendUser, auditUserSuspended
+		target, err = qtx.SuspendUser(r.Context(), userID)
+		if err == nil {
+			err = qtx.RevokeAllRefreshTokensForUser(r.Context(), userID)
+		}
+	} else {
+		target, err = qtx.UnsuspendUser(r.Context(), userID)
+	}
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't update user", err)
+		return
+	}
+
+	_, err = qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: principal.UserID, Valid: true},
+		Action:       action,
+		TargetUserID: uuid.NullUUID{UUID: userID, Valid: true},
+		Reason:       reason,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record moderation action", err)
+		return
+	}
+
+	err = writeAuditEvent(r, qtx, auditEvent{
+		Type:      auditType,
+		ActorID:   principal.UserID,
+		SubjectID: userID,
+		Metadata:  map[string]any{"reason": reason},
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record audit event", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit suspension", err)
+		return
+	}
+
+	if suspended {
+		err = cfg.denylist.RevokeAllForUser(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke access tokens", err)
+			return
+		}
+	}
+
+	// Response initiated ---
+	res := resBodyStruct{
+		ID:    target.ID,
+		Email: target.Email,
+	}
+	if target.SuspendedAt.Valid {
+		res.SuspendedAt = &target.SuspendedAt.Time
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// Moderator_ListUserChirpsHandler returns a user's most recent chirps, newest
+// first. With ?include_deleted=true it also returns deleted chirps that
+// haven't been purged yet, so they can be found and restored.
+func (cfg *apiConfig) Moderator_ListUserChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid user ID", err)
+		return
+	}
+
+	limit, err := parsePageLimit(r.URL.Query())
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+
+	includeDeleted := false
+	if includeDeletedString := r.URL.Query().Get("include_deleted"); includeDeletedString != "" {
+		includeDeleted, err = strconv.ParseBool(includeDeletedString)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "include_deleted must be true or false", err)
+			return
+		}
+	}
+
+	chirps, err := cfg.db.ListUserChirpsForModeration(r.Context(), database.ListUserChirpsForModerationParams{
+		UserID:         userID,
+		IncludeDeleted: includeDeleted,
+		RowLimit:       int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirps", err)
+		return
+	}
+
+	rendered, err := renderChirps(r.Context(), cfg.db, chirps)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirps", err)
+		return
+	}
+
+	// Response initiated ---
+	chirpResponses := []ModeratedChirp{}
+	for i, chirp := range chirps {
+		chirpResponse := ModeratedChirp{Chirp: rendered[i]}
+		if chirp.DeletedAt.Valid {
+			chirpResponse.DeletedAt = &chirp.DeletedAt.Time
+		}
+		if chirp.DeletedBy.Valid {
+			chirpResponse.DeletedBy = &chirp.DeletedBy.UUID
+		}
+		chirpResponses = append(chirpResponses, chirpResponse)
+	}
+
+	respondWithJSON(w, http.StatusOK, chirpResponses)
+}
+
+// Moderator_ListUserActionsHandler returns the moderation actions taken
+// against a user, newest first.
+func (cfg *apiConfig) Moderator_ListUserActionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid user ID", err)
+		return
+	}
+
+	limit, err := parsePageLimit(r.URL.Query())
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+
+	actions, err := cfg.db.ListModerationActionsForUser(r.Context(), database.ListModerationActionsForUserParams{
+		TargetUserID: uuid.NullUUID{UUID: userID, Valid: true},
+		Limit:        int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch moderation actions", err)
+		return
+	}
+
+	// Response initiated ---
+	actionResponses := []ModerationAction{}
+	for _, action := range actions {
+		actionResponses = append(actionResponses, moderationActionResponse(action))
+	}
+
+	respondWithJSON(w, http.StatusOK, actionResponses)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+	"githuv.com/grvbrk/go-server/internal/jobs"
+	"githuv.com/grvbrk/go-server/internal/mailer"
+)
+
+const passwordResetTokenTTL = time.Hour
+
+// PasswordResetRequestHandler emails a reset token. It answers 202 whether or
+// not the email belongs to an account so it can't be used to probe for users.
+func (cfg *apiConfig) PasswordResetRequestHandler(w http.ResponseWriter, r *http.Request) {
+	type reqBodyStruct struct {
+		Email string `json:"email"`
+	}
+
+	body := reqBodyStruct{}
+	err := decodeJSONBody(r, &body)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmail(r.Context(), body.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
+		return
+	}
+
+	// Sending from a job keeps the response time the same whether or not
+	// the account exists.
+	_, err = cfg.jobs.Enqueue(r.Context(), jobSendPasswordResetEmail, userJob{UserID: user.ID}, jobs.Options{})
+	if err != nil {
+		// Still answer 202; an error here would reveal that the account exists.
+		log.Printf("[%s] Couldn't queue reset email: %s", requestIDFromContext(r.Context()), err)
+	}
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordResetEmail issues a reset token for user and mails it to them.
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, user database.User) error {
+	resetToken, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(resetToken),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(`Someone asked to reset the password for your Chirpy account.
+
+Your reset token is: %s
+
+Or open %s/app/reset-password?token=%s
+
+The token expires in %s. If you didn't ask for this, ignore this email.`,
+			resetToken, cfg.base_url, resetToken, passwordResetTokenTTL),
+	})
+}
+
+// PasswordResetConfirmHandler sets a new password from a reset token and
+// signs the user out of every session.
+func (cfg *apiConfig) PasswordResetConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	type reqBodyStruct struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	body := reqBodyStruct{}
+	err := decodeJSONBody(r, &body)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+		return
+	}
+
+	if body.Token == "" || body.Password == "" {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Token and password are required", nil)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(body.Password)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't hash password", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	resetToken, err := qtx.ConsumePasswordResetToken(r.Context(), auth.HashToken(body.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidToken, "Reset token is invalid, expired or already used", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't look up reset token", err)
+		return
+	}
+
+	err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             resetToken.UserID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't update password", err)
+		return
+	}
+
+	err = qtx.InvalidatePasswordResetTokensForUser(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't invalidate reset tokens", err)
+		return
+	}
+
+	err = qtx.RevokeAllRefreshTokensForUser(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke sessions", err)
+		return
+	}
+
+	// Whoever holds the reset token is acting for the account owner.
+	err = writeAuditEvent(r, qtx, auditEvent{
+		Type:      auditPasswordReset,
+		ActorID:   resetToken.UserID,
+		SubjectID: resetToken.UserID,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record audit event", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit password reset", err)
+		return
+	}
+
+	// Access tokens issued before the reset stop working too.
+	err = cfg.denylist.RevokeAllForUser(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	cfg.recordAudit(r, auditEvent{
+		Type:      auditAllSessionsRevoked,
+		ActorID:   resetToken.UserID,
+		SubjectID: resetToken.UserID,
+		Metadata:  map[string]any{"reason": "password_reset"},
+	})
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// Chirp kinds as stored in chirps.kind.
+const (
+	chirpKindPost    = "post"
+	chirpKindRechirp = "rechirp"
+	chirpKindQuote   = "quote"
+)
+
+// referencedChirpID is the chirp a rechirp or quote points at.
+func referencedChirpID(chirp database.Chirp) uuid.NullUUID {
+	if chirp.RechirpOf.Valid {
+		return chirp.RechirpOf
+	}
+	return chirp.QuoteOf
+}
+
+// rechirpStore is the subset of database.Queries rechirping needs.
+type rechirpStore interface {
+	GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	CreateRechirp(ctx context.Context, arg database.CreateRechirpParams) (database.Chirp, error)
+	GetRechirpForUser(ctx context.Context, arg database.GetRechirpForUserParams) (database.Chirp, error)
+}
+
+// resolveRechirp fetches a chirp to reply to, quote or rechirp. For a
+// rechirp that is the chirp it reposts, so rechirps never point at rechirps.
+func resolveRechirp(ctx context.Context, q rechirpStore, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := q.GetChirpById(ctx, id)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if chirp.Kind == chirpKindRechirp {
+		return q.GetChirpById(ctx, chirp.RechirpOf.UUID)
+	}
+	return chirp, nil
+}
+
+// createRechirp reposts original for userID. If the user has already
+// rechirped it, their existing rechirp is returned with created false.
+func createRechirp(ctx context.Context, q rechirpStore, userID, originalID uuid.UUID) (database.Chirp, bool, error) {
+	rechirpOf := uuid.NullUUID{UUID: originalID, Valid: true}
+	rechirp, err := q.CreateRechirp(ctx, database.CreateRechirpParams{
+		UserID:    userID,
+		RechirpOf: rechirpOf,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		rechirp, err = q.GetRechirpForUser(ctx, database.GetRechirpForUserParams{
+			UserID:    userID,
+			RechirpOf: rechirpOf,
+		})
+		return rechirp, false, err
+	}
+	return rechirp, err == nil, err
+}
+
+// RechirpHandler reposts a chirp to the caller's feed. Rechirping the same
+// chirp again returns the existing rechirp.
+func (cfg *apiConfig) RechirpHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
+		return
+	}
+
+	if user.SuspendedAt.Valid {
+		respondWithError(w, r, http.StatusForbidden, errCodeAccountSuspended, "Your account is suspended", nil)
+		return
+	}
+
+	if cfg.require_email_verification && !user.EmailVerifiedAt.Valid {
+		respondWithError(w, r, http.StatusForbidden, errCodeEmailUnverified, "Verify your email before posting chirps", nil)
+		return
+	}
+
+	original, err := resolveRechirp(r.Context(), cfg.db, chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	rechirp, created, err := createRechirp(r.Context(), cfg.db, principal.UserID, original.ID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't rechirp", err)
+		return
+	}
+
+	if rechirp.DeletedAt.Valid {
+		respondWithError(w, r, http.StatusForbidden, errCodeForbidden, "Your rechirp of this chirp was removed by a moderator", nil)
+		return
+	}
+
+	res, err := renderChirp(r.Context(), cfg.db, rechirp)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch chirp", err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		cfg.emitWebhookEvent(r, rechirp.UserID, webhookEventChirpCreated, res)
+	}
+
+	// Response initiated ---
+	respondWithJSON(w, status, res)
+}
+
+// UndoRechirpHandler removes the caller's rechirp of a chirp. It works even
+// after the original has been deleted.
+func (cfg *apiConfig) UndoRechirpHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	rechirp, err := cfg.db.DeleteRechirpForUser(r.Context(), database.DeleteRechirpForUserParams{
+		UserID:    principal.UserID,
+		RechirpOf: uuid.NullUUID{UUID: chirpID, Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "You haven't rechirped this chirp", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't undo rechirp", err)
+		return
+	}
+
+	cfg.emitWebhookEvent(r, rechirp.UserID, webhookEventChirpDeleted, map[string]any{"id": rechirp.ID, "user_id": rechirp.UserID})
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusNoContent)
+}
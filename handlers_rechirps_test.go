@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// fakeRechirpStore keeps chirps in memory and enforces the one-rechirp-per-
+// user index the way CreateRechirp's ON CONFLICT DO NOTHING does.
+type fakeRechirpStore struct {
+	chirps    map[uuid.UUID]database.Chirp
+	createErr error
+}
+
+func newFakeRechirpStore(chirps ...database.Chirp) *fakeRechirpStore {
+	s := &fakeRechirpStore{chirps: map[uuid.UUID]database.Chirp{}}
+	for _, chirp := range chirps {
+		s.chirps[chirp.ID] = chirp
+	}
+	return s
+}
+
+func (s *fakeRechirpStore) GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, ok := s.chirps[id]
+	if !ok || chirp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (s *fakeRechirpStore) CreateRechirp(ctx context.Context, arg database.CreateRechirpParams) (database.Chirp, error) {
+	if s.createErr != nil {
+		return database.Chirp{}, s.createErr
+	}
+	if _, err := s.findRechirp(arg.UserID, arg.RechirpOf); err == nil {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	rechirp := database.Chirp{ID: uuid.New(), UserID: arg.UserID, Kind: chirpKindRechirp, RechirpOf: arg.RechirpOf}
+	s.chirps[rechirp.ID] = rechirp
+	return rechirp, nil
+}
+
+func (s *fakeRechirpStore) GetRechirpForUser(ctx context.Context, arg database.GetRechirpForUserParams) (database.Chirp, error) {
+	return s.findRechirp(arg.UserID, arg.RechirpOf)
+}
+
+func (s *fakeRechirpStore) findRechirp(userID uuid.UUID, rechirpOf uuid.NullUUID) (database.Chirp, error) {
+	for _, chirp := range s.chirps {
+		if chirp.Kind == chirpKindRechirp && chirp.UserID == userID && chirp.RechirpOf == rechirpOf {
+			return chirp, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func TestResolveRechirp(t *testing.T) {
+	post := database.Chirp{ID: uuid.New(), Kind: chirpKindPost}
+	quote := database.Chirp{ID: uuid.New(), Kind: chirpKindQuote, QuoteOf: uuid.NullUUID{UUID: post.ID, Valid: true}}
+	rechirp := database.Chirp{ID: uuid.New(), Kind: chirpKindRechirp, RechirpOf: uuid.NullUUID{UUID: post.ID, Valid: true}}
+	deletedPost := database.Chirp{ID: uuid.New(), Kind: chirpKindPost, DeletedAt: sql.NullTime{Valid: true}}
+	orphan := database.Chirp{ID: uuid.New(), Kind: chirpKindRechirp, RechirpOf: uuid.NullUUID{UUID: deletedPost.ID, Valid: true}}
+	store := newFakeRechirpStore(post, quote, rechirp, deletedPost, orphan)
+
+	tests := []struct {
+		name    string
+		id      uuid.UUID
+		want    uuid.UUID
+		wantErr error
+	}{
+		{name: "Post", id: post.ID, want: post.ID},
+		{name: "Quote stays a quote", id: quote.ID, want: quote.ID},
+		{name: "Rechirp resolves to the original", id: rechirp.ID, want: post.ID},
+		{name: "Unknown chirp", id: uuid.New(), wantErr: sql.ErrNoRows},
+		{name: "Rechirp of a deleted chirp", id: orphan.ID, wantErr: sql.ErrNoRows},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveRechirp(context.Background(), store, tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveRechirp() error = %v, want %v", err, tt.wantErr)
+			}
+			if got.ID != tt.want {
+				t.Errorf("resolveRechirp() = %v, want %v", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateRechirp(t *testing.T) {
+	ctx := context.Background()
+	user := uuid.New()
+	post := database.Chirp{ID: uuid.New(), Kind: chirpKindPost}
+	rechirp := database.Chirp{ID: uuid.New(), UserID: uuid.New(), Kind: chirpKindRechirp, RechirpOf: uuid.NullUUID{UUID: post.ID, Valid: true}}
+	store := newFakeRechirpStore(post, rechirp)
+
+	first, created, err := createRechirp(ctx, store, user, post.ID)
+	if err != nil || !created {
+		t.Fatalf("createRechirp() = created %v, error %v, want a new rechirp", created, err)
+	}
+	if first.Kind != chirpKindRechirp || first.RechirpOf.UUID != post.ID {
+		t.Fatalf("createRechirp() = %+v, want a rechirp of %v", first, post.ID)
+	}
+
+	tests := []struct {
+		name string
+		id   uuid.UUID
+	}{
+		{name: "Same chirp again", id: post.ID},
+		{name: "Someone else's rechirp of it", id: rechirp.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original, err := resolveRechirp(ctx, store, tt.id)
+			if err != nil {
+				t.Fatalf("resolveRechirp() error = %v", err)
+			}
+			got, created, err := createRechirp(ctx, store, user, original.ID)
+			if err != nil {
+				t.Fatalf("createRechirp() error = %v", err)
+			}
+			if created || got.ID != first.ID {
+				t.Errorf("createRechirp() = %v, created %v, want existing %v", got.ID, created, first.ID)
+			}
+		})
+	}
+
+	t.Run("Store error", func(t *testing.T) {
+		store := newFakeRechirpStore(post)
+		store.createErr = errors.New("connection reset")
+		if _, created, err := createRechirp(ctx, store, user, post.ID); err == nil || created {
+			t.Errorf("createRechirp() = created %v, error %v, want the store error", created, err)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+func (cfg *apiConfig) Admin_SetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	type reqBodyStruct struct {
+		Role string `json:"role"`
+	}
+
+	type resBodyStruct struct {
+		ID        uuid.UUID `json:"id"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Email     string    `json:"email"`
+		Role      string    `json:"role"`
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid user ID", err)
+		return
+	}
+
+	body := reqBodyStruct{}
+	err = decodeJSONBody(r, &body)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+		return
+	}
+
+	role, err := auth.ParseRole(body.Role)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Role must be user, moderator or admin", err)
+		return
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	user, err := qtx.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   userID,
+		Role: string(role),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Couldn't find user", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't update role", err)
+		return
+	}
+
+	// Nobody could promote anyone again without an admin left.
+	admins, err := qtx.CountUsersWithRole(r.Context(), string(auth.RoleAdmin))
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't count admins", err)
+		return
+	}
+	if admins == 0 {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Can't demote the last admin", nil)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit role change", err)
+		return
+	}
+
+	cfg.recordAudit(r, auditEvent{
+		Type:      auditAdminUserRoleChanged,
+		ActorID:   principal.UserID,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"role": user.Role},
+	})
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, resBodyStruct{
+		ID:        user.ID,
+		UpdatedAt: user.UpdatedAt,
+		Email:     user.Email,
+		Role:      user.Role,
+	})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// Session is one login, i.e. one refresh token family. Its ID stays the same
+// across refresh token rotations.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func (cfg *apiConfig) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	sessions, err := cfg.db.ListActiveSessionsForUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch sessions", err)
+		return
+	}
+
+	// Response initiated ---
+	sessionResponses := []Session{}
+	for _, session := range sessions {
+		sessionResponses = append(sessionResponses, Session{
+			ID:         session.FamilyID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+			CreatedAt:  session.StartedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.FamilyID == principal.SessionID,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, sessionResponses)
+}
+
+func (cfg *apiConfig) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid session ID", err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokeSessionForUser(r.Context(), database.RevokeSessionForUserParams{
+		FamilyID: sessionID,
+		UserID:   principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke session", err)
+		return
+	}
+
+	if revoked == 0 {
+		respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Session not found", nil)
+		return
+	}
+
+	// Access tokens already issued from the session stop working too.
+	err = cfg.denylist.RevokeSession(r.Context(), principal.UserID, sessionID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	cfg.recordAudit(r, auditEvent{
+		Type:      auditRefreshTokenRevoked,
+		ActorID:   principal.UserID,
+		SubjectID: principal.UserID,
+		Metadata:  map[string]any{"session_id": sessionID},
+	})
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessionsHandler signs the caller out everywhere except the
+// session their access token was issued from.
+func (cfg *apiConfig) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	if principal.SessionID == uuid.Nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Access token isn't tied to a session; log in again", nil)
+		return
+	}
+
+	revokedFamilies, err := cfg.db.RevokeOtherSessionsForUser(r.Context(), database.RevokeOtherSessionsForUserParams{
+		UserID:   principal.UserID,
+		FamilyID: principal.SessionID,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke sessions", err)
+		return
+	}
+
+	// Every unrevoked token of a family is returned; each session only
+	// needs denylisting once.
+	revokedSessions := map[uuid.UUID]bool{}
+	for _, familyID := range revokedFamilies {
+		if revokedSessions[familyID] {
+			continue
+		}
+		revokedSessions[familyID] = true
+		err = cfg.denylist.RevokeSession(r.Context(), principal.UserID, familyID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke access tokens", err)
+			return
+		}
+	}
+
+	cfg.recordAudit(r, auditEvent{
+		Type:      auditOtherSessionsRevoked,
+		ActorID:   principal.UserID,
+		SubjectID: principal.UserID,
+		Metadata:  map[string]any{"kept_session_id": principal.SessionID, "revoked_tokens": len(revokedFamilies)},
+	})
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutHandler ends the caller's session: the access token they sent and
+// any other issued from the same session are denylisted, and its refresh
+// token family is revoked.
+func (cfg *apiConfig) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	err := cfg.denylist.RevokeToken(r.Context(), principal)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke access token", err)
+		return
+	}
+
+	if principal.SessionID != uuid.Nil {
+		err = cfg.db.RevokeRefreshTokenFamily(r.Context(), principal.SessionID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke session", err)
+			return
+		}
+
+		err = cfg.denylist.RevokeSession(r.Context(), principal.UserID, principal.SessionID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke access tokens", err)
+			return
+		}
+	}
+
+	cfg.recordAudit(r, auditEvent{
+		Type:      auditRefreshTokenRevoked,
+		ActorID:   principal.UserID,
+		SubjectID: principal.UserID,
+		Metadata:  map[string]any{"session_id": principal.SessionID, "reason": "logout"},
+	})
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAllHandler signs the caller out of every session and invalidates
+// every access token issued to them so far, including the one they sent.
+func (cfg *apiConfig) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	err := cfg.db.RevokeAllRefreshTokensForUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke sessions", err)
+		return
+	}
+
+	err = cfg.denylist.RevokeAllForUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	cfg.recordAudit(r, auditEvent{
+		Type:      auditAllSessionsRevoked,
+		ActorID:   principal.UserID,
+		SubjectID: principal.UserID,
+		Metadata:  map[string]any{"session_id": principal.SessionID, "reason": "logout_all"},
+	})
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+	"githuv.com/grvbrk/go-server/internal/subscription"
+)
+
+// subscriptionExpiryInterval is how often the expire_subscriptions job
+// marks lapsed subscriptions expired. Red status is derived from the period
+// end, so this only affects the stored status and history, not who gets Red
+// features.
+const subscriptionExpiryInterval = time.Minute
+
+// applySubscriptionEvent moves userID's subscription through a Polka event
+// inside qtx and records it in the history. changed is false when the event
+// had nothing to act on.
+func applySubscriptionEvent(ctx context.Context, qtx *database.Queries, userID uuid.UUID, event subscription.Event, periodEnd time.Time, webhookEventID string) (next subscription.State, changed bool, err error) {
+	var current *subscription.State
+	sub, err := qtx.GetSubscriptionForUpdate(ctx, userID)
+	if err == nil {
+		current = &subscription.State{
+			Status:    subscription.Status(sub.Status),
+			PeriodEnd: sub.CurrentPeriodEnd,
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return subscription.State{}, false, err
+	}
+
+	next, changed, err = subscription.Apply(current, event, periodEnd, time.Now().UTC())
+	if err != nil || !changed {
+		return next, changed, err
+	}
+
+	_, err = qtx.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:           userID,
+		Status:           string(next.Status),
+		CurrentPeriodEnd: next.PeriodEnd,
+	})
+	if err != nil {
+		return subscription.State{}, false, err
+	}
+
+	err = qtx.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+		UserID:           userID,
+		EventType:        string(event),
+		Status:           string(next.Status),
+		CurrentPeriodEnd: next.PeriodEnd,
+		WebhookEventID:   sql.NullString{String: webhookEventID, Valid: webhookEventID != ""},
+	})
+	if err != nil {
+		return subscription.State{}, false, err
+	}
+
+	return next, true, nil
+}
+
+// expireSubscriptions marks every lapsed subscription expired and records
+// it in the history.
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context) (int, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	expired, err := qtx.ExpireSubscriptions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sub := range expired {
+		err = qtx.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+			UserID:           sub.UserID,
+			EventType:        "expired",
+			Status:           sub.Status,
+			CurrentPeriodEnd: sub.CurrentPeriodEnd,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(expired), tx.Commit()
+}
+
+func (cfg *apiConfig) GetSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	type historyEntry struct {
+		Event            string    `json:"event"`
+		Status           string    `json:"status"`
+		CurrentPeriodEnd time.Time `json:"current_period_end"`
+		CreatedAt        time.Time `json:"created_at"`
+	}
+
+	type resBodyStruct struct {
+		IsChirpyRed      bool           `json:"is_chirpy_red"`
+		Status           string         `json:"status"`
+		CurrentPeriodEnd *time.Time     `json:"current_period_end"`
+		History          []historyEntry `json:"history"`
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	res := resBodyStruct{Status: "none", History: []historyEntry{}}
+
+	sub, err := cfg.db.GetSubscription(r.Context(), principal.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't look up subscription", err)
+		return
+	}
+	if err == nil {
+		state := subscription.State{Status: subscription.Status(sub.Status), PeriodEnd: sub.CurrentPeriodEnd}
+		res.IsChirpyRed = state.IsChirpyRed(time.Now().UTC())
+		res.Status = sub.Status
+		res.CurrentPeriodEnd = &sub.CurrentPeriodEnd
+	}
+
+	events, err := cfg.db.ListSubscriptionEventsForUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't list subscription history", err)
+		return
+	}
+	for _, e := range events {
+		res.History = append(res.History, historyEntry{
+			Event:            e.EventType,
+			Status:           e.Status,
+			CurrentPeriodEnd: e.CurrentPeriodEnd,
+			CreatedAt:        e.CreatedAt,
+		})
+	}
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, res)
+}
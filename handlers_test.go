@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+func TestCheckRefreshToken(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	earlier := sql.NullTime{Time: now.Add(-time.Minute), Valid: true}
+
+	fresh := database.RefreshToken{
+		UserID:    uuid.New(),
+		FamilyID:  uuid.New(),
+		ExpiresAt: now.Add(refreshTokenTTL),
+	}
+	rotated := fresh
+	rotated.RotatedAt = earlier
+	revoked := fresh
+	revoked.RevokedAt = earlier
+	expired := fresh
+	expired.ExpiresAt = now.Add(-time.Second)
+	expiresNow := fresh
+	expiresNow.ExpiresAt = now
+	rotatedThenRevoked := rotated
+	rotatedThenRevoked.RevokedAt = earlier
+	rotatedThenExpired := rotated
+	rotatedThenExpired.ExpiresAt = now.Add(-time.Second)
+
+	tests := []struct {
+		name  string
+		token database.RefreshToken
+		want  refreshTokenStatus
+	}{
+		{name: "Fresh token", token: fresh, want: refreshTokenUsable},
+		{name: "Rotated token", token: rotated, want: refreshTokenReused},
+		{name: "Revoked token", token: revoked, want: refreshTokenInvalid},
+		{name: "Expired token", token: expired, want: refreshTokenInvalid},
+		{name: "Expires now", token: expiresNow, want: refreshTokenInvalid},
+		{name: "Reuse after family revoked", token: rotatedThenRevoked, want: refreshTokenReused},
+		{name: "Reuse after expiry", token: rotatedThenExpired, want: refreshTokenReused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkRefreshToken(tt.token, now); got != tt.want {
+				t.Errorf("checkRefreshToken() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Duplicate quotes, restores and queued jobs all surface as a unique
+// violation, which handlers answer with 409 errCodeConflict.
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Unique violation", err: &pq.Error{Code: "23505"}, want: true},
+		{name: "Wrapped unique violation", err: fmt.Errorf("create chirp: %w", &pq.Error{Code: "23505"}), want: true},
+		{name: "Foreign key violation", err: &pq.Error{Code: "23503"}, want: false},
+		{name: "No rows", err: sql.ErrNoRows, want: false},
+		{name: "Other error", err: errors.New("23505"), want: false},
+		{name: "Nil", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUniqueViolation(tt.err); got != tt.want {
+				t.Errorf("isUniqueViolation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+const (
+	twoFactorChallengeTTL = time.Minute * 5
+	twoFactorIssuer       = "Chirpy"
+	recoveryCodeCount     = 10
+)
+
+// TwoFactorEnrollHandler generates a new, not yet active TOTP secret. It only
+// takes effect once TwoFactorConfirmHandler sees a valid code for it.
+func (cfg *apiConfig) TwoFactorEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	type resBodyStruct struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, r, http.StatusConflict, errCodeTwoFactorEnabled, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't generate TOTP secret", err)
+		return
+	}
+
+	_, err = cfg.db.SetPendingTOTPSecret(r.Context(), database.SetPendingTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't save TOTP secret", err)
+		return
+	}
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, resBodyStruct{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, user.Email, twoFactorIssuer),
+	})
+}
+
+// TwoFactorConfirmHandler turns 2FA on and hands out recovery codes. The
+// codes are only ever shown in this response.
+func (cfg *apiConfig) TwoFactorConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	type reqBodyStruct struct {
+		Code string `json:"code"`
+	}
+
+	type resBodyStruct struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	body := reqBodyStruct{}
+	err := decodeJSONBody(r, &body)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, r, http.StatusConflict, errCodeTwoFactorEnabled, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	if !user.TotpSecret.Valid {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Start enrollment before confirming", nil)
+		return
+	}
+
+	if !auth.ValidateTOTP(user.TotpSecret.String, body.Code, time.Now()) {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidTwoFactorCode, "Code is not valid", nil)
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't generate recovery codes", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.DeleteRecoveryCodesForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't clear recovery codes", err)
+		return
+	}
+
+	for _, code := range recoveryCodes {
+		err = qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashRecoveryCode(code),
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't save recovery codes", err)
+			return
+		}
+	}
+
+	_, err = qtx.EnableTOTP(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	err = writeAuditEvent(r, qtx, auditEvent{
+		Type:      auditTwoFactorEnabled,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record audit event", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit two-factor enrollment", err)
+		return
+	}
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, resBodyStruct{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// TwoFactorDisableHandler turns 2FA off. It needs the password and a current
+// code or unused recovery code, so a stolen access token alone isn't enough.
+func (cfg *apiConfig) TwoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	type reqBodyStruct struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	body := reqBodyStruct{}
+	err := decodeJSONBody(r, &body)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Two-factor authentication is not enabled", nil)
+		return
+	}
+
+	if body.Code == "" && body.RecoveryCode == "" {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Either code or recovery_code is required", nil)
+		return
+	}
+
+	if !cfg.reauthenticate(w, r, user, body.Password) {
+		return
+	}
+
+	failure, err := cfg.checkTwoFactorCode(r.Context(), user, body.Code, body.RecoveryCode)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't check code", err)
+		return
+	}
+	if failure != "" {
+		err = cfg.loginThrottle.RecordFailure(r.Context(), user.Email, clientIP(r))
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record login attempt", err)
+			return
+		}
+		respondWithError(w, r, http.StatusUnauthorized, errCodeInvalidTwoFactorCode, "Code is not valid", nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.DisableTOTP(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	err = qtx.DeleteRecoveryCodesForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't delete recovery codes", err)
+		return
+	}
+
+	err = writeAuditEvent(r, qtx, auditEvent{
+		Type:      auditTwoFactorDisabled,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record audit event", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit two-factor removal", err)
+		return
+	}
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginTwoFactorHandler is the second login step. It takes the challenge
+// token from LoginUser plus either a TOTP code or an unused recovery code.
+func (cfg *apiConfig) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	type reqBodyStruct struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	body := reqBodyStruct{}
+	err := decodeJSONBody(r, &body)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+		return
+	}
+
+	userID, err := auth.ValidateChallengeJWT(body.ChallengeToken, cfg.jwt_keys)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Challenge token is invalid or expired", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't find user", err)
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Two-factor authentication is not enabled", nil)
+		return
+	}
+
+	if user.SuspendedAt.Valid {
+		respondWithError(w, r, http.StatusForbidden, errCodeAccountSuspended, "Your account is suspended", nil)
+		return
+	}
+
+	if body.Code == "" && body.RecoveryCode == "" {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Either code or recovery_code is required", nil)
+		return
+	}
+
+	// Wrong codes count against the same account and IP lockouts as wrong
+	// passwords, so a challenge token can't be used to guess freely.
+	ip := clientIP(r)
+	wait, err := cfg.loginThrottle.Check(r.Context(), user.Email, ip)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't check login attempts", err)
+		return
+	}
+	if wait > 0 {
+		cfg.recordAudit(r, auditEvent{
+			Type:      auditLoginLocked,
+			SubjectID: user.ID,
+			Metadata:  map[string]any{"email": user.Email, "retry_after_seconds": int(wait.Seconds())},
+		})
+		respondWithLoginLocked(w, r, wait)
+		return
+	}
+
+	failure, err := cfg.checkTwoFactorCode(r.Context(), user, body.Code, body.RecoveryCode)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't check code", err)
+		return
+	}
+
+	if failure != "" {
+		cfg.recordAudit(r, auditEvent{
+			Type:      auditLoginFailed,
+			SubjectID: user.ID,
+			Metadata:  map[string]any{"email": user.Email, "reason": failure},
+		})
+
+		err = cfg.loginThrottle.RecordFailure(r.Context(), user.Email, ip)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record login attempt", err)
+			return
+		}
+		respondWithError(w, r, http.StatusUnauthorized, errCodeInvalidTwoFactorCode, "Code is not valid", nil)
+		return
+	}
+
+	err = cfg.loginThrottle.RecordSuccess(r.Context(), user.Email)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record login attempt", err)
+		return
+	}
+
+	cfg.respondWithNewSession(w, r, user)
+}
+
+// checkTwoFactorCode checks a TOTP code, or failing that a recovery code,
+// and uses it up. It returns why the check failed, or "" if it passed.
+func (cfg *apiConfig) checkTwoFactorCode(ctx context.Context, user database.User, code, recoveryCode string) (string, error) {
+	if code != "" {
+		step, ok := auth.MatchTOTP(user.TotpSecret.String, code, time.Now())
+		if !ok {
+			return "invalid_two_factor_code", nil
+		}
+
+		// A code stays valid for up to three steps; only its first use counts.
+		used, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			Step: step,
+			ID:   user.ID,
+		})
+		if err != nil {
+			return "", err
+		}
+		if used == 0 {
+			return "reused_two_factor_code", nil
+		}
+		return "", nil
+	}
+
+	_, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   user.ID,
+		CodeHash: auth.HashRecoveryCode(recoveryCode),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "invalid_recovery_code", nil
+	}
+	return "", err
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+	"githuv.com/grvbrk/go-server/internal/jobs"
+	"githuv.com/grvbrk/go-server/internal/webhook"
+)
+
+// Events users can subscribe their webhook endpoints to.
+const (
+	webhookEventChirpCreated  = "chirp.created"
+	webhookEventChirpUpdated  = "chirp.updated"
+	webhookEventChirpDeleted  = "chirp.deleted"
+	webhookEventChirpRestored = "chirp.restored"
+	webhookEventUserUpdated   = "user.updated"
+	// Only sent by POST /api/webhooks/{endpointID}/test.
+	webhookEventPing = "ping"
+)
+
+var webhookEvents = []string{webhookEventChirpCreated, webhookEventChirpUpdated, webhookEventChirpDeleted, webhookEventChirpRestored, webhookEventUserUpdated}
+
+const (
+	maxWebhookEndpointsPerUser = 10
+	webhookDeliveryTimeout     = 10 * time.Second
+)
+
+// webhookRetryPolicy retries a failing delivery for about three hours before
+// giving up on it.
+var webhookRetryPolicy = webhook.RetryPolicy{
+	MaxAttempts: 10,
+	BaseDelay:   30 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// webhookPayload is the JSON body of every delivery.
+type webhookPayload struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// emitWebhookEvent queues a delivery of event to each of userID's endpoints
+// subscribed to it. Like recordAudit, failures are logged rather than
+// failing a request that has already taken effect.
+func (cfg *apiConfig) emitWebhookEvent(r *http.Request, userID uuid.UUID, event string, data any) {
+	endpoints, err := cfg.db.ListWebhookEndpointsForEvent(r.Context(), database.ListWebhookEndpointsForEventParams{
+		UserID:    userID,
+		EventType: event,
+	})
+	if err != nil {
+		log.Printf("[%s] Couldn't look up webhook endpoints for %s: %s", requestIDFromContext(r.Context()), event, err)
+		return
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+
+	eventID := uuid.New()
+	payload, err := json.Marshal(webhookPayload{
+		ID:        eventID,
+		Type:      event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		log.Printf("[%s] Couldn't encode webhook payload for %s: %s", requestIDFromContext(r.Context()), event, err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("[%s] Couldn't start transaction for %s: %s", requestIDFromContext(r.Context()), event, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	for _, endpoint := range endpoints {
+		delivery, err := qtx.CreateWebhookDelivery(r.Context(), database.CreateWebhookDeliveryParams{
+			EndpointID: endpoint.ID,
+			EventID:    eventID,
+			EventType:  event,
+			Payload:    payload,
+		})
+		if err != nil {
+			log.Printf("[%s] Couldn't create webhook delivery for %s: %s", requestIDFromContext(r.Context()), event, err)
+			return
+		}
+
+		err = queueWebhookDelivery(r.Context(), qtx, delivery)
+		if err != nil {
+			log.Printf("[%s] Couldn't queue webhook delivery for %s: %s", requestIDFromContext(r.Context()), event, err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("[%s] Couldn't commit webhook deliveries for %s: %s", requestIDFromContext(r.Context()), event, err)
+	}
+}
+
+// queueWebhookDelivery schedules a job to attempt delivery when it is next
+// due. Pass a transaction-bound store to queue it along with the delivery.
+func queueWebhookDelivery(ctx context.Context, store jobs.Enqueuer, delivery database.WebhookDelivery) error {
+	_, err := jobs.Enqueue(ctx, store, jobDeliverWebhook, deliverWebhookJob{DeliveryID: delivery.ID}, jobs.Options{
+		RunAt: delivery.NextAttemptAt,
+	})
+	return err
+}
+
+// attemptWebhookDelivery sends delivery once and records the outcome. A
+// failure is rescheduled according to webhookRetryPolicy, or marked failed
+// once it runs out of attempts.
+func (cfg *apiConfig) attemptWebhookDelivery(ctx context.Context, delivery database.WebhookDelivery) (database.WebhookDelivery, error) {
+	endpoint, err := cfg.db.GetWebhookEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		return database.WebhookDelivery{}, err
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, webhookDeliveryTimeout)
+	statusCode, sendErr := cfg.webhookSender.Send(sendCtx, webhook.Delivery{
+		ID:     delivery.ID.String(),
+		Event:  delivery.EventType,
+		URL:    endpoint.Url,
+		Secret: []byte(endpoint.Secret),
+		Body:   delivery.Payload,
+	})
+	cancel()
+
+	params := database.RecordWebhookDeliveryAttemptParams{
+		ID:             delivery.ID,
+		Status:         "succeeded",
+		NextAttemptAt:  delivery.NextAttemptAt,
+		ResponseStatus: sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0},
+	}
+	if sendErr != nil {
+		params.LastError = sql.NullString{String: sendErr.Error(), Valid: true}
+		delay, retry := webhookRetryPolicy.Next(int(delivery.Attempts) + 1)
+		if retry {
+			params.Status = "pending"
+			params.NextAttemptAt = time.Now().UTC().Add(delay)
+		} else {
+			params.Status = "failed"
+		}
+	}
+
+	return cfg.db.RecordWebhookDeliveryAttempt(ctx, params)
+}
+
+// validateWebhookURL only accepts absolute http(s) URLs, and plain http
+// only in dev.
+func (cfg *apiConfig) validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("URL must be absolute")
+	}
+	if u.User != nil {
+		return errors.New("URL can't contain credentials")
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && cfg.platform == "dev") {
+		return errors.New("URL must use https")
+	}
+	return nil
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	// Only returned when the endpoint is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	EventID        uuid.UUID       `json:"event_id"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	ResponseStatus *int32          `json:"response_status"`
+	LastError      *string         `json:"last_error"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+func newWebhookDelivery(delivery database.WebhookDelivery) WebhookDelivery {
+	res := WebhookDelivery{
+		ID:        delivery.ID,
+		CreatedAt: delivery.CreatedAt,
+		EventID:   delivery.EventID,
+		Event:     delivery.EventType,
+		Status:    delivery.Status,
+		Attempts:  delivery.Attempts,
+		Payload:   delivery.Payload,
+	}
+	if delivery.Status == "pending" {
+		res.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.LastAttemptAt.Valid {
+		res.LastAttemptAt = &delivery.LastAttemptAt.Time
+	}
+	if delivery.ResponseStatus.Valid {
+		res.ResponseStatus = &delivery.ResponseStatus.Int32
+	}
+	if delivery.LastError.Valid {
+		res.LastError = &delivery.LastError.String
+	}
+	return res
+}
+
+func (cfg *apiConfig) CreateWebhookEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	type reqBodyStruct struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	body := reqBodyStruct{}
+	err := decodeJSONBody(r, &body)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidJSON, "Request body is not valid JSON", err)
+		return
+	}
+
+	err = cfg.validateWebhookURL(body.URL)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error(), err)
+		return
+	}
+
+	if len(body.Events) == 0 {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "At least one event is required", nil)
+		return
+	}
+	for _, event := range body.Events {
+		if !slices.Contains(webhookEvents, event) {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Unknown event: "+event, nil)
+			return
+		}
+	}
+	slices.Sort(body.Events)
+	body.Events = slices.Compact(body.Events)
+
+	existing, err := cfg.db.ListWebhookEndpointsForUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch webhook endpoints", err)
+		return
+	}
+	if len(existing) >= maxWebhookEndpointsPerUser {
+		respondWithError(w, r, http.StatusConflict, errCodeConflict, "You already have the maximum number of webhook endpoints", nil)
+		return
+	}
+
+	secretBytes := make([]byte, 32)
+	_, err = rand.Read(secretBytes)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't generate secret", err)
+		return
+	}
+
+	endpoint, err := cfg.db.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID: principal.UserID,
+		Url:    body.URL,
+		Secret: "whsec_" + hex.EncodeToString(secretBytes),
+		Events: body.Events,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't create webhook endpoint", err)
+		return
+	}
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusCreated, WebhookEndpoint{
+		ID:        endpoint.ID,
+		CreatedAt: endpoint.CreatedAt,
+		URL:       endpoint.Url,
+		Events:    endpoint.Events,
+		Secret:    endpoint.Secret,
+	})
+}
+
+func (cfg *apiConfig) ListWebhookEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	endpoints, err := cfg.db.ListWebhookEndpointsForUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch webhook endpoints", err)
+		return
+	}
+
+	// Response initiated ---
+	endpointResponses := []WebhookEndpoint{}
+	for _, endpoint := range endpoints {
+		endpointResponses = append(endpointResponses, WebhookEndpoint{
+			ID:        endpoint.ID,
+			CreatedAt: endpoint.CreatedAt,
+			URL:       endpoint.Url,
+			Events:    endpoint.Events,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, endpointResponses)
+}
+
+func (cfg *apiConfig) DeleteWebhookEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return
+	}
+
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid endpoint ID", err)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteWebhookEndpointForUser(r.Context(), database.DeleteWebhookEndpointForUserParams{
+		ID:     endpointID,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't delete webhook endpoint", err)
+		return
+	}
+
+	if deleted == 0 {
+		respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Webhook endpoint not found", nil)
+		return
+	}
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// endpointForRequest loads the {endpointID} in the path if it belongs to
+// the caller. It has already responded when ok is false.
+func (cfg *apiConfig) endpointForRequest(w http.ResponseWriter, r *http.Request) (endpoint database.WebhookEndpoint, ok bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Not authenticated", nil)
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid endpoint ID", err)
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpoint, err = cfg.db.GetWebhookEndpointForUser(r.Context(), database.GetWebhookEndpointForUserParams{
+		ID:     endpointID,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Webhook endpoint not found", err)
+			return database.WebhookEndpoint{}, false
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch webhook endpoint", err)
+		return database.WebhookEndpoint{}, false
+	}
+
+	return endpoint, true
+}
+
+// TestWebhookEndpointHandler sends a ping event to the endpoint straight
+// away and responds with the outcome. A failed ping is retried like any
+// other delivery.
+func (cfg *apiConfig) TestWebhookEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.endpointForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	eventID := uuid.New()
+	payload, err := json.Marshal(webhookPayload{
+		ID:        eventID,
+		Type:      webhookEventPing,
+		CreatedAt: time.Now().UTC(),
+		Data:      map[string]any{"endpoint_id": endpoint.ID},
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't encode payload", err)
+		return
+	}
+
+	delivery, err := cfg.db.CreateWebhookDelivery(r.Context(), database.CreateWebhookDeliveryParams{
+		EndpointID: endpoint.ID,
+		EventID:    eventID,
+		EventType:  webhookEventPing,
+		Payload:    payload,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't create delivery", err)
+		return
+	}
+
+	delivery, err = cfg.attemptWebhookDelivery(r.Context(), delivery)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't record delivery", err)
+		return
+	}
+
+	if delivery.Status == "pending" {
+		err = queueWebhookDelivery(r.Context(), cfg.db, delivery)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't queue retry", err)
+			return
+		}
+	}
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusOK, newWebhookDelivery(delivery))
+}
+
+// ListWebhookDeliveriesHandler pages through an endpoint's delivery log,
+// newest first, like GET /api/chirps.
+func (cfg *apiConfig) ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.endpointForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := parsePageLimit(query)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error(), err)
+		return
+	}
+
+	params := database.ListWebhookDeliveriesForEndpointParams{
+		EndpointID: endpoint.ID,
+		RowLimit:   int32(limit + 1),
+	}
+	if cursorString := query.Get("cursor"); cursorString != "" {
+		cursor, err := decodeCursor(cursorString)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid cursor", err)
+			return
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	deliveries, err := cfg.db.ListWebhookDeliveriesForEndpoint(r.Context(), params)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch deliveries", err)
+		return
+	}
+
+	nextCursor := ""
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		last := deliveries[len(deliveries)-1]
+		nextCursor = encodeCursor(keysetCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	// Response initiated ---
+	deliveryResponses := []WebhookDelivery{}
+	for _, delivery := range deliveries {
+		deliveryResponses = append(deliveryResponses, newWebhookDelivery(delivery))
+	}
+
+	if nextCursor != "" {
+		w.Header().Set("X-Next-Cursor", nextCursor)
+		w.Header().Set("Link", nextPageLink(r.URL, nextCursor))
+	}
+	respondWithJSON(w, http.StatusOK, deliveryResponses)
+}
+
+// RedeliverWebhookHandler queues a fresh copy of a past delivery. It keeps
+// the original event ID and payload so receivers can tell it's a repeat.
+func (cfg *apiConfig) RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.endpointForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid delivery ID", err)
+		return
+	}
+
+	original, err := cfg.db.GetWebhookDeliveryForEndpoint(r.Context(), database.GetWebhookDeliveryForEndpointParams{
+		ID:         deliveryID,
+		EndpointID: endpoint.ID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Delivery not found", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch delivery", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	delivery, err := qtx.CreateWebhookDelivery(r.Context(), database.CreateWebhookDeliveryParams{
+		EndpointID: endpoint.ID,
+		EventID:    original.EventID,
+		EventType:  original.EventType,
+		Payload:    original.Payload,
+	})
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't create delivery", err)
+		return
+	}
+
+	err = queueWebhookDelivery(r.Context(), qtx, delivery)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't queue delivery", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't commit delivery", err)
+		return
+	}
+
+	// Response initiated ---
+	respondWithJSON(w, http.StatusAccepted, newWebhookDelivery(delivery))
+}
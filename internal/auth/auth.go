@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -26,42 +28,149 @@ func CheckPasswordHash(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	JwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy-access",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
-	})
-	return JwtToken.SignedString([]byte(tokenSecret))
+// AccessTokenClaims are the claims carried by a Chirpy access token.
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+	// SessionID is the refresh token family the access token was issued
+	// from. It is empty for tokens not tied to a session.
+	SessionID string `json:"sid,omitempty"`
+	// IssuedAtMillis is iat in Unix milliseconds. iat itself is whole
+	// seconds, too coarse to tell whether the token predates a revocation
+	// made in the same second.
+	IssuedAtMillis int64 `json:"iat_ms,omitempty"`
+}
+
+func MakeJWT(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return MakeSessionJWT(userID, uuid.Nil, keys, expiresIn)
+}
+
+// MakeSessionJWT is MakeJWT with the session (refresh token family) recorded
+// in the `sid` claim.
+func MakeSessionJWT(userID, sessionID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	claims := AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    "chirpy-access",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		IssuedAtMillis: now.UnixMilli(),
+	}
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
+
+	return keys.sign(claims)
+}
 
+// RevocationChecker reports whether an otherwise valid access token has been
+// revoked, either by its jti or because the user's tokens were invalidated
+// after it was issued.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, principal Principal) (bool, error)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(tokenSecret), nil
-		})
+var ErrTokenRevoked = errors.New("token has been revoked")
 
+// ValidateJWT verifies an access token against the key named by its `kid`
+// header, checks it against revocations (which may be nil) and returns the
+// user it was issued to.
+func ValidateJWT(ctx context.Context, tokenString string, keys *KeySet, revocations RevocationChecker) (uuid.UUID, error) {
+	principal, err := ValidateAccessToken(ctx, tokenString, keys, revocations)
 	if err != nil {
 		return uuid.Nil, err
 	}
+	return principal.UserID, nil
+}
 
-	userIDString, err := token.Claims.GetSubject()
+// ValidateAccessToken is ParseAccessToken plus the revocation check.
+func ValidateAccessToken(ctx context.Context, tokenString string, keys *KeySet, revocations RevocationChecker) (Principal, error) {
+	principal, err := ParseAccessToken(tokenString, keys)
 	if err != nil {
-		return uuid.Nil, err
+		return Principal{}, err
+	}
+
+	if revocations != nil {
+		revoked, err := revocations.IsRevoked(ctx, principal)
+		if err != nil {
+			return Principal{}, fmt.Errorf("checking revocation: %w", err)
+		}
+		if revoked {
+			return Principal{}, ErrTokenRevoked
+		}
+	}
+	return principal, nil
+}
+
+// ParseAccessToken checks an access token's signature and claims and returns
+// the principal it was issued to. It does not consult any denylist.
+func ParseAccessToken(tokenString string, keys *KeySet) (Principal, error) {
+	claims := &AccessTokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc, validMethods)
+
+	if err != nil {
+		return Principal{}, err
+	}
+
+	if claims.Issuer != "chirpy-access" {
+		return Principal{}, errors.New("invalid issuer")
 	}
 
-	issuer, err := token.Claims.GetIssuer()
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return Principal{}, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return Principal{}, errors.New("token is missing jti, iat or exp")
+	}
+
+	principal := Principal{
+		UserID:    id,
+		TokenID:   claims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	// Tokens issued before iat_ms existed fall back to the whole-second iat,
+	// which errs towards treating them as revoked.
+	if claims.IssuedAtMillis != 0 {
+		principal.IssuedAt = time.UnixMilli(claims.IssuedAtMillis)
+	}
+	if claims.SessionID != "" {
+		principal.SessionID, err = uuid.Parse(claims.SessionID)
+		if err != nil {
+			return Principal{}, fmt.Errorf("invalid session ID: %w", err)
+		}
+	}
+	return principal, nil
+}
+
+// MakeChallengeJWT issues the short-lived token returned by the first step of
+// a two-factor login. Its issuer differs from access tokens, so it can't be
+// used to call the API.
+func MakeChallengeJWT(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return keys.sign(jwt.RegisteredClaims{
+		Issuer:    "chirpy-2fa-challenge",
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		Subject:   userID.String(),
+	})
+}
+
+func ValidateChallengeJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc, validMethods)
 	if err != nil {
 		return uuid.Nil, err
 	}
 
-	if issuer != "chirpy-access" {
+	if claims.Issuer != "chirpy-2fa-challenge" {
 		return uuid.Nil, errors.New("invalid issuer")
 	}
 
-	id, err := uuid.Parse(userIDString)
+	id, err := uuid.Parse(claims.Subject)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
 	}
@@ -82,6 +191,12 @@ func GetBearerToken(headers http.Header) (string, error) {
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeOpaqueToken()
+}
+
+// MakeOpaqueToken returns 32 random bytes, hex encoded. It backs refresh
+// tokens and single-use tokens such as password resets.
+func MakeOpaqueToken() (string, error) {
 	token := make([]byte, 32)
 	_, err := rand.Read(token)
 	if err != nil {
@@ -90,6 +205,18 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(token), nil
 }
 
+// HashRefreshToken returns the hex SHA-256 digest of a refresh token. Only
+// the digest is stored; the token itself is never persisted.
+func HashRefreshToken(token string) string {
+	return HashToken(token)
+}
+
+// HashToken returns the hex SHA-256 digest of an opaque token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // GetAPIKey -
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
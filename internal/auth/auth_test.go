@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"net/http"
 	"testing"
 	"time"
@@ -65,33 +66,41 @@ func TestCheckPasswordHash(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	keys := newTestKeySet(t, "key-1")
+	validToken, _ := MakeJWT(userID, keys, time.Hour)
 
 	tests := []struct {
 		name        string
 		tokenString string
-		tokenSecret string
+		keys        *KeySet
 		wantUserID  uuid.UUID
 		wantErr     bool
 	}{
 		{
 			name:        "Valid token",
 			tokenString: validToken,
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  userID,
 			wantErr:     false,
 		},
 		{
 			name:        "Invalid token",
 			tokenString: "invalid.token.string",
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
 		{
-			name:        "Wrong secret",
+			name:        "Wrong key",
 			tokenString: validToken,
-			tokenSecret: "wrong_secret",
+			keys:        newTestKeySet(t, "key-1"),
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "Unknown key ID",
+			tokenString: validToken,
+			keys:        newTestKeySet(t, "key-2"),
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
@@ -99,7 +108,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotUserID, err := ValidateJWT(context.Background(), tt.tokenString, tt.keys, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -155,3 +164,154 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestHashRefreshToken(t *testing.T) {
+	token, _ := MakeRefreshToken()
+	otherToken, _ := MakeRefreshToken()
+
+	hash := HashRefreshToken(token)
+	if hash == token {
+		t.Errorf("HashRefreshToken() returned the token unchanged")
+	}
+	if len(hash) != 64 {
+		t.Errorf("HashRefreshToken() len = %v, want 64", len(hash))
+	}
+	if HashRefreshToken(token) != hash {
+		t.Errorf("HashRefreshToken() is not deterministic")
+	}
+	if HashRefreshToken(otherToken) == hash {
+		t.Errorf("HashRefreshToken() collided for different tokens")
+	}
+
+	// Must match Postgres' encode(sha256(...), 'hex') used by the migration.
+	want := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if got := HashRefreshToken("test"); got != want {
+		t.Errorf("HashRefreshToken(\"test\") = %v, want %v", got, want)
+	}
+}
+
+func TestParseAccessToken(t *testing.T) {
+	userID := uuid.New()
+	sessionID := uuid.New()
+	keys := newTestKeySet(t, "key-1")
+	issuedAfter := time.Now().Truncate(time.Millisecond)
+	sessionToken, _ := MakeSessionJWT(userID, sessionID, keys, time.Hour)
+	plainToken, _ := MakeJWT(userID, keys, time.Hour)
+
+	tests := []struct {
+		name          string
+		tokenString   string
+		wantSessionID uuid.UUID
+		wantErr       bool
+	}{
+		{
+			name:          "Token with session",
+			tokenString:   sessionToken,
+			wantSessionID: sessionID,
+			wantErr:       false,
+		},
+		{
+			name:          "Token without session",
+			tokenString:   plainToken,
+			wantSessionID: uuid.Nil,
+			wantErr:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAccessToken(tt.tokenString, keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseAccessToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.UserID != userID {
+				t.Errorf("ParseAccessToken() UserID = %v, want %v", got.UserID, userID)
+			}
+			if got.SessionID != tt.wantSessionID {
+				t.Errorf("ParseAccessToken() SessionID = %v, want %v", got.SessionID, tt.wantSessionID)
+			}
+			if got.IssuedAt.Before(issuedAfter) || got.IssuedAt.After(time.Now()) {
+				t.Errorf("ParseAccessToken() IssuedAt = %v, want millisecond precision after %v", got.IssuedAt, issuedAfter)
+			}
+		})
+	}
+}
+
+func TestValidateChallengeJWT(t *testing.T) {
+	userID := uuid.New()
+	keys := newTestKeySet(t, "key-1")
+	challengeToken, _ := MakeChallengeJWT(userID, keys, time.Minute)
+	accessToken, _ := MakeJWT(userID, keys, time.Hour)
+
+	gotUserID, err := ValidateChallengeJWT(challengeToken, keys)
+	if err != nil || gotUserID != userID {
+		t.Errorf("ValidateChallengeJWT() = %v, %v, want %v", gotUserID, err, userID)
+	}
+
+	if _, err := ValidateChallengeJWT(accessToken, keys); err == nil {
+		t.Errorf("ValidateChallengeJWT() accepted an access token")
+	}
+
+	if _, err := ValidateJWT(context.Background(), challengeToken, keys, nil); err == nil {
+		t.Errorf("ValidateJWT() accepted a challenge token")
+	}
+}
+
+type fakeRevocations struct {
+	revokedJTI string
+	validAfter time.Time
+}
+
+func (f fakeRevocations) IsRevoked(ctx context.Context, principal Principal) (bool, error) {
+	return principal.TokenID == f.revokedJTI || principal.IssuedAt.Before(f.validAfter), nil
+}
+
+func TestValidateJWTRevocation(t *testing.T) {
+	userID := uuid.New()
+	keys := newTestKeySet(t, "key-1")
+	token, _ := MakeJWT(userID, keys, time.Hour)
+	principal, err := ParseAccessToken(token, keys)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	if principal.TokenID == "" {
+		t.Fatalf("ParseAccessToken() TokenID is empty")
+	}
+
+	tests := []struct {
+		name        string
+		revocations RevocationChecker
+		wantErr     bool
+	}{
+		{
+			name:        "No checker",
+			revocations: nil,
+			wantErr:     false,
+		},
+		{
+			name:        "Not revoked",
+			revocations: fakeRevocations{revokedJTI: "other"},
+			wantErr:     false,
+		},
+		{
+			name:        "jti on denylist",
+			revocations: fakeRevocations{revokedJTI: principal.TokenID},
+			wantErr:     true,
+		},
+		{
+			name:        "Issued before tokens_valid_after",
+			revocations: fakeRevocations{validAfter: time.Now().Add(time.Minute)},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateJWT(context.Background(), token, keys, tt.revocations)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a JWT signing or verification key identified by its `kid`.
+type Key struct {
+	ID         string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer // nil for verification-only keys
+	publicKey  crypto.PublicKey
+}
+
+// NewKey wraps an RSA or Ed25519 key. Pass a private key to be able to sign
+// with it, or a public key to only verify.
+func NewKey(kid string, key interface{}) (*Key, error) {
+	if kid == "" {
+		return nil, errors.New("key ID is required")
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: kid, method: jwt.SigningMethodRS256, privateKey: k, publicKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: kid, method: jwt.SigningMethodRS256, publicKey: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, method: jwt.SigningMethodEdDSA, privateKey: k, publicKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, method: jwt.SigningMethodEdDSA, publicKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// GenerateEd25519Key returns a fresh signing key. Handy for tests and for dev
+// servers that have no key configured.
+func GenerateEd25519Key(kid string) (*Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(kid, priv)
+}
+
+// ParseKeyPEM reads a PKCS#8 private key or PKIX public key.
+func ParseKeyPEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(kid, key)
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(kid, key)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(kid, key)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// KeySet holds the key new tokens are signed with plus every key tokens may
+// still be verified with. Keeping retired keys around lets tokens signed
+// before a rotation stay valid until they expire.
+type KeySet struct {
+	signingKey *Key
+	keys       map[string]*Key
+}
+
+func NewKeySet(signingKID string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	signingKey, ok := ks.keys[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found", signingKID)
+	}
+	if signingKey.privateKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKID)
+	}
+	ks.signingKey = signingKey
+	return ks, nil
+}
+
+// LoadKeySet reads every *.pem file in dir, using the file name without the
+// extension as the key ID.
+func LoadKeySet(dir, signingKID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []*Key{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParseKeyPEM(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return NewKeySet(signingKID, keys...)
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signingKey.method, claims)
+	token.Header["kid"] = ks.signingKey.ID
+	return token.SignedString(ks.signingKey.privateKey)
+}
+
+// keyFunc picks the verification key by the token's `kid` header and makes
+// sure the token's alg matches that key.
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("token has no kid header")
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("key %q doesn't accept alg %s", kid, token.Method.Alg())
+	}
+	return key.publicKey, nil
+}
+
+var validMethods = jwt.WithValidMethods([]string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+})
+
+// JWK is a public key in RFC 7517 JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every key in the set, sorted by key ID.
+func (ks *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := JWK{
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: key.method.Alg(),
+		}
+
+		switch pub := key.publicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
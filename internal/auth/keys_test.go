@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestKeySet(t *testing.T, kid string) *KeySet {
+	t.Helper()
+	key, err := GenerateEd25519Key(kid)
+	if err != nil {
+		t.Fatalf("GenerateEd25519Key() error = %v", err)
+	}
+	keys, err := NewKeySet(kid, key)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	return keys
+}
+
+func TestKeySetRotation(t *testing.T) {
+	userID := uuid.New()
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(rsaPrivate)
+	oldKey, err := ParseKeyPEM("old", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	if err != nil {
+		t.Fatalf("ParseKeyPEM() error = %v", err)
+	}
+	newKey, _ := GenerateEd25519Key("new")
+
+	before, _ := NewKeySet("old", oldKey)
+	oldToken, err := MakeJWT(userID, before, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	after, _ := NewKeySet("new", oldKey, newKey)
+	newToken, _ := MakeJWT(userID, after, time.Hour)
+
+	for name, token := range map[string]string{"RS256 token from old key": oldToken, "EdDSA token from new key": newToken} {
+		gotUserID, err := ValidateJWT(context.Background(), token, after, nil)
+		if err != nil || gotUserID != userID {
+			t.Errorf("%s: ValidateJWT() = %v, %v, want %v", name, gotUserID, err, userID)
+		}
+	}
+
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	if parsed.Header["kid"] != "new" || parsed.Header["alg"] != "EdDSA" {
+		t.Errorf("token header = %v, want kid new and alg EdDSA", parsed.Header)
+	}
+}
+
+func TestKeySetRejectsHMACWithPublicKey(t *testing.T) {
+	keys := newTestKeySet(t, "key-1")
+	pub := keys.keys["key-1"].publicKey
+
+	// Classic alg confusion: sign HS256 using the public key bytes as secret.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "chirpy-access",
+		Subject:   uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	forged.Header["kid"] = "key-1"
+	forgedString, _ := forged.SignedString([]byte(pub.(ed25519.PublicKey)))
+
+	if _, err := ValidateJWT(context.Background(), forgedString, keys, nil); err == nil {
+		t.Errorf("ValidateJWT() accepted an HS256 token")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaPrivate, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaKey, _ := NewKey("b-rsa", rsaPrivate)
+	edKey, _ := GenerateEd25519Key("a-ed")
+	keys, _ := NewKeySet("a-ed", rsaKey, edKey)
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() len = %v, want 2", len(jwks.Keys))
+	}
+
+	ed, rs := jwks.Keys[0], jwks.Keys[1]
+	if ed.KeyID != "a-ed" || ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.Algorithm != "EdDSA" || ed.X == "" {
+		t.Errorf("JWKS() Ed25519 key = %+v", ed)
+	}
+	if rs.KeyID != "b-rsa" || rs.KeyType != "RSA" || rs.Algorithm != "RS256" || rs.N == "" || rs.E != "AQAB" {
+		t.Errorf("JWKS() RSA key = %+v", rs)
+	}
+}
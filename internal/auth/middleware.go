@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID uuid.UUID
+	// SessionID is uuid.Nil when the access token isn't tied to a session.
+	SessionID uuid.UUID
+
+	// TokenID is the access token's jti. IssuedAt has millisecond
+	// precision, taken from iat_ms when the token carries it.
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored by RequireAuth or
+// OptionalAuth, if any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator validates bearer access tokens and exposes the result to
+// handlers through the request context.
+type Authenticator struct {
+	Keys *KeySet
+	// Revocations is optional; without it revoked tokens stay valid until
+	// they expire.
+	Revocations RevocationChecker
+
+	// Roles looks up a user's current role. It is only needed by
+	// RequireRole, which asks on every request so that a demotion applies
+	// straight away.
+	Roles func(ctx context.Context, userID uuid.UUID) (Role, error)
+
+	// Unauthorized writes the response for a rejected request. It defaults
+	// to a bare 401.
+	Unauthorized func(w http.ResponseWriter, r *http.Request, err error)
+	// Forbidden writes the response for an authenticated caller without
+	// the required role. It defaults to a bare 403.
+	Forbidden func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (Principal, error) {
+	token, err := GetBearerToken(r.Header)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	return ValidateAccessToken(r.Context(), token, a.Keys, a.Revocations)
+}
+
+func (a *Authenticator) unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	if a.Unauthorized != nil {
+		a.Unauthorized(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (a *Authenticator) forbidden(w http.ResponseWriter, r *http.Request, err error) {
+	if a.Forbidden != nil {
+		a.Forbidden(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusForbidden)
+}
+
+// RequireAuth rejects requests without a valid access token.
+func (a *Authenticator) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.authenticate(r)
+		if err != nil {
+			a.unauthorized(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// OptionalAuth lets anonymous requests through, but a request that does send
+// an Authorization header must carry a valid access token.
+func (a *Authenticator) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		principal, err := a.authenticate(r)
+		if err != nil {
+			a.unauthorized(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// RequireRole rejects requests without a valid access token, and requests
+// from users whose role doesn't include role.
+func (a *Authenticator) RequireRole(role Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := a.authenticate(r)
+			if err != nil {
+				a.unauthorized(w, r, err)
+				return
+			}
+
+			if a.Roles == nil {
+				a.forbidden(w, r, errors.New("no role lookup configured"))
+				return
+			}
+			userRole, err := a.Roles(r.Context(), principal.UserID)
+			if err != nil {
+				a.forbidden(w, r, fmt.Errorf("couldn't look up role: %w", err))
+				return
+			}
+			if !userRole.Includes(role) {
+				a.forbidden(w, r, fmt.Errorf("role %q doesn't include %q", userRole, role))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAuthenticatorMiddleware(t *testing.T) {
+	userID := uuid.New()
+	keys := newTestKeySet(t, "key-1")
+	validToken, _ := MakeJWT(userID, keys, time.Hour)
+	authenticator := &Authenticator{Keys: keys}
+
+	tests := []struct {
+		name          string
+		optional      bool
+		authHeader    string
+		wantStatus    int
+		wantPrincipal bool
+	}{
+		{
+			name:          "Required with valid token",
+			authHeader:    "Bearer " + validToken,
+			wantStatus:    http.StatusOK,
+			wantPrincipal: true,
+		},
+		{
+			name:       "Required without token",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Required with invalid token",
+			authHeader: "Bearer invalid.token.string",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Optional with valid token",
+			optional:      true,
+			authHeader:    "Bearer " + validToken,
+			wantStatus:    http.StatusOK,
+			wantPrincipal: true,
+		},
+		{
+			name:       "Optional without token",
+			optional:   true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Optional with invalid token",
+			optional:   true,
+			authHeader: "Bearer invalid.token.string",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPrincipal := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, ok := PrincipalFromContext(r.Context())
+				gotPrincipal = ok
+				if ok && principal.UserID != userID {
+					t.Errorf("PrincipalFromContext() UserID = %v, want %v", principal.UserID, userID)
+				}
+			})
+
+			handler := authenticator.RequireAuth(next)
+			if tt.optional {
+				handler = authenticator.OptionalAuth(next)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if gotPrincipal != tt.wantPrincipal {
+				t.Errorf("principal present = %v, want %v", gotPrincipal, tt.wantPrincipal)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	keys := newTestKeySet(t, "key-1")
+	roles := map[uuid.UUID]Role{}
+	tokenFor := func(role Role) string {
+		userID := uuid.New()
+		roles[userID] = role
+		token, _ := MakeJWT(userID, keys, time.Hour)
+		return token
+	}
+
+	authenticator := &Authenticator{
+		Keys: keys,
+		Roles: func(ctx context.Context, userID uuid.UUID) (Role, error) {
+			return roles[userID], nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		required   Role
+		authHeader string
+		wantStatus int
+	}{
+		{
+			name:       "Admin on admin route",
+			required:   RoleAdmin,
+			authHeader: "Bearer " + tokenFor(RoleAdmin),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Admin on moderator route",
+			required:   RoleModerator,
+			authHeader: "Bearer " + tokenFor(RoleAdmin),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Moderator on admin route",
+			required:   RoleAdmin,
+			authHeader: "Bearer " + tokenFor(RoleModerator),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "User on moderator route",
+			required:   RoleModerator,
+			authHeader: "Bearer " + tokenFor(RoleUser),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Unknown role",
+			required:   RoleUser,
+			authHeader: "Bearer " + tokenFor(Role("root")),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "No token",
+			required:   RoleAdmin,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := PrincipalFromContext(r.Context()); !ok {
+					t.Errorf("PrincipalFromContext() found no principal")
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			authenticator.RequireRole(tt.required)(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
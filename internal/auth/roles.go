@@ -0,0 +1,36 @@
+package auth
+
+import "fmt"
+
+// Role is what a user is allowed to do beyond managing their own account.
+// Roles are ordered: each one includes everything the ones below it can do.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// ParseRole returns the role named s.
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return role, nil
+}
+
+// Includes reports whether r grants everything other does. Unknown roles
+// neither include nor are included by anything.
+func (r Role) Includes(other Role) bool {
+	rank, ok := roleRanks[r]
+	otherRank, otherOK := roleRanks[other]
+	return ok && otherOK && rank >= otherRank
+}
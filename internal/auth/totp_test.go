@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 appendix B SHA1 seed, truncated to the last six digits.
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name string
+		code string
+		time time.Time
+		want bool
+	}{
+		{
+			name: "RFC vector at 59s",
+			code: "287082",
+			time: time.Unix(59, 0),
+			want: true,
+		},
+		{
+			name: "RFC vector at 1111111109s",
+			code: "081804",
+			time: time.Unix(1111111109, 0),
+			want: true,
+		},
+		{
+			name: "Previous step within skew",
+			code: "287082",
+			time: time.Unix(59+totpPeriod, 0),
+			want: true,
+		},
+		{
+			name: "Outside skew",
+			code: "287082",
+			time: time.Unix(59+3*totpPeriod, 0),
+			want: false,
+		},
+		{
+			name: "Wrong code",
+			code: "000000",
+			time: time.Unix(59, 0),
+			want: false,
+		},
+		{
+			name: "Wrong length",
+			code: "94287082",
+			time: time.Unix(59, 0),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateTOTP(secret, tt.code, tt.time); got != tt.want {
+				t.Errorf("ValidateTOTP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchTOTPStep(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	// 287082 is the code for step 1; a check one step later still matches
+	// it within the skew and must report step 1, not the current one.
+	step, ok := MatchTOTP(secret, "287082", time.Unix(59+totpPeriod, 0))
+	if !ok || step != 1 {
+		t.Errorf("MatchTOTP() = %d, %v, want 1, true", step, ok)
+	}
+
+	step, ok = MatchTOTP(secret, "000000", time.Unix(59, 0))
+	if ok || step != 0 {
+		t.Errorf("MatchTOTP() = %d, %v, want 0, false", step, ok)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "user@example.com", "Chirpy")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:user@example.com?") {
+		t.Errorf("TOTPURI() = %v, unexpected label", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=Chirpy") {
+		t.Errorf("TOTPURI() = %v, missing secret or issuer", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("GenerateRecoveryCodes() len = %v, want 10", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("GenerateRecoveryCodes() code %q has wrong format", code)
+		}
+		if seen[code] {
+			t.Errorf("GenerateRecoveryCodes() returned duplicate %q", code)
+		}
+		seen[code] = true
+	}
+
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if HashRecoveryCode(typed) != HashRecoveryCode(codes[0]) {
+		t.Errorf("HashRecoveryCode() doesn't normalize %q", typed)
+	}
+}
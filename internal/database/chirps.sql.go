@@ -7,25 +7,74 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countChirpReplies = `-- name: CountChirpReplies :many
+SELECT in_reply_to::uuid AS chirp_id, COUNT(*) AS reply_count
+FROM chirps
+WHERE in_reply_to = ANY($1::uuid[]) AND deleted_at IS NULL
+GROUP BY in_reply_to
+`
+
+type CountChirpRepliesRow struct {
+	ChirpID    uuid.UUID
+	ReplyCount int64
+}
+
+func (q *Queries) CountChirpReplies(ctx context.Context, chirpIds []uuid.UUID) ([]CountChirpRepliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, countChirpReplies, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountChirpRepliesRow
+	for rows.Next() {
+		var i CountChirpRepliesRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.ReplyCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, kind, quote_of)
 VALUES (
-gen_random_uuid(), NOW(), NOW(), $1, $2
+gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	Kind      string
+	QuoteOf   uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+		arg.Kind,
+		arg.QuoteOf,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -33,23 +82,88 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.Kind,
+		&i.RechirpOf,
+		&i.QuoteOf,
 	)
 	return i, err
 }
 
-const deleteChirpById = `-- name: DeleteChirpById :exec
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, kind, rechirp_of)
+VALUES (
+gen_random_uuid(), NOW(), NOW(), '', $1, 'rechirp', $2
+)
+ON CONFLICT (user_id, rechirp_of) WHERE kind = 'rechirp' DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
+`
+
+type CreateRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+// CreateRechirp returns sql.ErrNoRows when the user has already rechirped the
+// chirp.
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.Kind,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const deleteRechirpForUser = `-- name: DeleteRechirpForUser :one
 DELETE FROM chirps
-WHERE id = $1
+WHERE user_id = $1 AND rechirp_of = $2 AND kind = 'rechirp' AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
 `
 
-func (q *Queries) DeleteChirpById(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirpById, id)
-	return err
+type DeleteRechirpForUserParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirpForUser(ctx context.Context, arg DeleteRechirpForUserParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, deleteRechirpForUser, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.Kind,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
 }
 
 const getAllChirpsInAsc = `-- name: GetAllChirpsInAsc :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
 FROM chirps
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -68,6 +182,13 @@ func (q *Queries) GetAllChirpsInAsc(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.Kind,
+			&i.RechirpOf,
+			&i.QuoteOf,
 		); err != nil {
 			return nil, err
 		}
@@ -83,9 +204,9 @@ func (q *Queries) GetAllChirpsInAsc(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpById = `-- name: GetChirpById :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
 FROM chirps
-WHERE id = $1
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -97,26 +218,598 @@ func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.Kind,
+		&i.RechirpOf,
+		&i.QuoteOf,
 	)
 	return i, err
 }
 
-const upgradeToChirpyRed = `-- name: UpgradeToChirpyRed :one
-UPDATE users SET is_chirpy_red = true, updated_at = NOW()
+const getChirpByIdForUpdate = `-- name: GetChirpByIdForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
+FROM chirps
+WHERE id = $1 AND deleted_at IS NULL
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpByIdForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByIdForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.Kind,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const getChirpsByIds = `-- name: GetChirpsByIds :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
+FROM chirps
+WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+`
+
+func (q *Queries) GetChirpsByIds(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIds, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.Kind,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeletedChirpForUpdate = `-- name: GetDeletedChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
+FROM chirps
+WHERE id = $1 AND deleted_at IS NOT NULL
+FOR UPDATE
+`
+
+func (q *Queries) GetDeletedChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getDeletedChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.Kind,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const getRechirpForUser = `-- name: GetRechirpForUser :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
+FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2 AND kind = 'rechirp'
+`
+
+type GetRechirpForUserParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+// GetRechirpForUser includes a rechirp a moderator removed, which still
+// blocks the user from rechirping the chirp again.
+func (q *Queries) GetRechirpForUser(ctx context.Context, arg GetRechirpForUserParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getRechirpForUser, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.Kind,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const listChirpAncestors = `-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.in_reply_to, 1 AS depth
+    FROM chirps parent
+    JOIN chirps child ON child.in_reply_to = parent.id
+    WHERE child.id = $1 AND parent.deleted_at IS NULL
+    UNION ALL
+    SELECT c.id, c.in_reply_to, a.depth + 1
+    FROM chirps c
+    JOIN ancestors a ON c.id = a.in_reply_to
+    WHERE c.deleted_at IS NULL
+)
+SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.edited_at, c.deleted_at, c.deleted_by, c.in_reply_to, c.kind, c.rechirp_of, c.quote_of
+FROM chirps c
+JOIN ancestors a ON a.id = c.id
+ORDER BY a.depth DESC
+`
+
+// ListChirpAncestors returns the chain of chirps a chirp replies to, root first.
+// It stops at the first deleted ancestor.
+func (q *Queries) ListChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.Kind,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpDescendants = `-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT id, 1 AS depth
+    FROM chirps
+    WHERE in_reply_to = $1::uuid AND deleted_at IS NULL
+    UNION ALL
+    SELECT c.id, d.depth + 1
+    FROM chirps c
+    JOIN descendants d ON c.in_reply_to = d.id
+    WHERE c.deleted_at IS NULL AND d.depth < $2::int
+)
+SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.edited_at, c.deleted_at, c.deleted_by, c.in_reply_to, c.kind, c.rechirp_of, c.quote_of
+FROM chirps c
+JOIN descendants d ON d.id = c.id
+ORDER BY d.depth, c.created_at, c.id
+LIMIT $3
+`
+
+type ListChirpDescendantsParams struct {
+	RootID   uuid.UUID
+	MaxDepth int32
+	RowLimit int32
+}
+
+// ListChirpDescendants returns the replies under a chirp down to max_depth,
+// a level at a time, so a truncated result never has a reply without its
+// parent. Replies under a deleted chirp are left out.
+func (q *Queries) ListChirpDescendants(ctx context.Context, arg ListChirpDescendantsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpDescendants, arg.RootID, arg.MaxDepth, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.Kind,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpReplies = `-- name: ListChirpReplies :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
+FROM chirps
+WHERE in_reply_to = $1::uuid AND deleted_at IS NULL
+AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpRepliesParams struct {
+	ParentID        uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListChirpReplies(ctx context.Context, arg ListChirpRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpReplies,
+		arg.ParentID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.Kind,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
+FROM chirps
+WHERE deleted_at IS NULL
+AND ($1::uuid IS NULL OR user_id = $1)
+AND ($1::uuid IS NOT NULL OR kind <> 'rechirp')
+AND (
+    rechirp_of IS NULL
+    OR EXISTS (SELECT 1 FROM chirps original WHERE original.id = chirps.rechirp_of AND original.deleted_at IS NULL)
+)
+AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpsAscParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.Kind,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
+FROM chirps
+WHERE deleted_at IS NULL
+AND ($1::uuid IS NULL OR user_id = $1)
+AND ($1::uuid IS NOT NULL OR kind <> 'rechirp')
+AND (
+    rechirp_of IS NULL
+    OR EXISTS (SELECT 1 FROM chirps original WHERE original.id = chirps.rechirp_of AND original.deleted_at IS NULL)
+)
+AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) < ($2::timestamp, $3::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.Kind,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserChirpsForModeration = `-- name: ListUserChirpsForModeration :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
+FROM chirps
+WHERE user_id = $1
+AND ($2::boolean OR deleted_at IS NULL)
+ORDER BY created_at DESC, id DESC
+LIMIT $3
+`
+
+type ListUserChirpsForModerationParams struct {
+	UserID         uuid.UUID
+	IncludeDeleted bool
+	RowLimit       int32
+}
+
+func (q *Queries) ListUserChirpsForModeration(ctx context.Context, arg ListUserChirpsForModerationParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listUserChirpsForModeration, arg.UserID, arg.IncludeDeleted, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.Kind,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps SET deleted_at = NULL,
+deleted_by = NULL,
+updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
 `
 
-func (q *Queries) UpgradeToChirpyRed(ctx context.Context, id uuid.UUID) (User, error) {
-	row := q.db.QueryRowContext(ctx, upgradeToChirpyRed, id)
-	var i User
+func (q *Queries) RestoreChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, id)
+	var i Chirp
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.Email,
-		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.Kind,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :execrows
+UPDATE chirps SET deleted_at = NOW(),
+deleted_by = $2,
+updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+type SoftDeleteChirpParams struct {
+	ID        uuid.UUID
+	DeletedBy uuid.NullUUID
+}
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, arg SoftDeleteChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteChirp, arg.ID, arg.DeletedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps SET body = $2,
+edited_at = NOW(),
+updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, edited_at, deleted_at, deleted_by, in_reply_to, kind, rechirp_of, quote_of
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.Kind,
+		&i.RechirpOf,
+		&i.QuoteOf,
 	)
 	return i, err
 }
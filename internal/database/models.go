@@ -6,33 +6,196 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	EventType string
+	ActorID   uuid.NullUUID
+	SubjectID uuid.NullUUID
+	IpAddress string
+	UserAgent string
+	RequestID string
+	Metadata  json.RawMessage
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	EditedAt  sql.NullTime
+	DeletedAt sql.NullTime
+	DeletedBy uuid.NullUUID
+	InReplyTo uuid.NullUUID
+	Kind      string
+	RechirpOf uuid.NullUUID
+	QuoteOf   uuid.NullUUID
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	WrittenAt  time.Time
+	ReplacedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	UserID    uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Job struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Kind        string
+	Payload     json.RawMessage
+	Status      string
+	Attempts    int32
+	MaxAttempts int32
+	RunAt       time.Time
+	LockedUntil sql.NullTime
+	LastError   sql.NullString
+	UniqueKey   sql.NullString
+	LockedBy    sql.NullString
+}
+
+type LoginThrottle struct {
+	Scope        string
+	Subject      string
+	Failures     int32
+	LastFailedAt time.Time
+	LockedUntil  sql.NullTime
+}
+
+type ModerationAction struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	ModeratorID   uuid.NullUUID
+	Action        string
+	TargetUserID  uuid.NullUUID
+	TargetChirpID uuid.NullUUID
+	ChirpBody     sql.NullString
+	Reason        string
+}
+
+type PasswordResetToken struct {
+	TokenHash string
 	UserID    uuid.UUID
+	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+}
+
+type ProcessedWebhookEvent struct {
+	Source      string
+	EventID     string
+	EventType   string
+	ProcessedAt time.Time
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	RotatedAt  sql.NullTime
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt time.Time
+}
+
+type RevokedAccessToken struct {
+	Jti       string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt time.Time
+}
+
+type RevokedSession struct {
+	SessionID uuid.UUID
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt time.Time
+}
+
+type Subscription struct {
+	UserID           uuid.UUID
+	Status           string
+	CurrentPeriodEnd time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+type SubscriptionEvent struct {
+	ID               uuid.UUID
+	UserID           uuid.UUID
+	EventType        string
+	Status           string
+	CurrentPeriodEnd time.Time
+	WebhookEventID   sql.NullString
+	CreatedAt        time.Time
+}
+
+type TotpRecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
 }
 
 type User struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	EmailVerifiedAt  sql.NullTime
+	TotpSecret       sql.NullString
+	TotpEnabledAt    sql.NullTime
+	TokensValidAfter sql.NullTime
+	Role             string
+	SuspendedAt      sql.NullTime
+	TotpLastStep     sql.NullInt64
+}
+
+type WebhookDelivery struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	EndpointID     uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	LastError      sql.NullString
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Url       string
+	Secret    string
+	Events    []string
 }
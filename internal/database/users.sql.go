@@ -7,10 +7,24 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const countUsersWithRole = `-- name: CountUsersWithRole :one
+SELECT COUNT(*)
+FROM users
+WHERE role = $1
+`
+
+func (q *Queries) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersWithRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -20,7 +34,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, tokens_valid_after, role, suspended_at, totp_last_step
 `
 
 type CreateUserParams struct {
@@ -37,7 +51,13 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.TotpLastStep,
 	)
 	return i, err
 }
@@ -61,8 +81,45 @@ func (q *Queries) DeleteUserByEmail(ctx context.Context, email string) error {
 	return err
 }
 
+const disableTOTP = `-- name: DisableTOTP :exec
+UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) DisableTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableTOTP, id)
+	return err
+}
+
+const enableTOTP = `-- name: EnableTOTP :one
+UPDATE users SET totp_enabled_at = NOW(), updated_at = NOW()
+WHERE id = $1
+AND totp_secret IS NOT NULL
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, tokens_valid_after, role, suspended_at, totp_last_step
+`
+
+func (q *Queries) EnableTOTP(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, enableTOTP, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, tokens_valid_after, role, suspended_at, totp_last_step
 FROM users
 WHERE email = $1
 `
@@ -76,15 +133,235 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, tokens_valid_after, role, suspended_at, totp_last_step
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const listRecentTokensValidAfter = `-- name: ListRecentTokensValidAfter :many
+SELECT id, tokens_valid_after
+FROM users
+WHERE tokens_valid_after > $1
+`
+
+type ListRecentTokensValidAfterRow struct {
+	ID               uuid.UUID
+	TokensValidAfter sql.NullTime
+}
+
+func (q *Queries) ListRecentTokensValidAfter(ctx context.Context, tokensValidAfter sql.NullTime) ([]ListRecentTokensValidAfterRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRecentTokensValidAfter, tokensValidAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRecentTokensValidAfterRow
+	for rows.Next() {
+		var i ListRecentTokensValidAfterRow
+		if err := rows.Scan(&i.ID, &i.TokensValidAfter); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :one
+UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, tokens_valid_after, role, suspended_at, totp_last_step
+`
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, markEmailVerified, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const setPendingTOTPSecret = `-- name: SetPendingTOTPSecret :one
+UPDATE users SET totp_secret = $2, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, tokens_valid_after, role, suspended_at, totp_last_step
+`
+
+type SetPendingTOTPSecretParams struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) SetPendingTOTPSecret(ctx context.Context, arg SetPendingTOTPSecretParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setPendingTOTPSecret, arg.ID, arg.TotpSecret)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const setTokensValidAfter = `-- name: SetTokensValidAfter :one
+UPDATE users SET tokens_valid_after = NOW(), updated_at = NOW()
+WHERE id = $1
+RETURNING tokens_valid_after
+`
+
+func (q *Queries) SetTokensValidAfter(ctx context.Context, id uuid.UUID) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, setTokensValidAfter, id)
+	var tokens_valid_after sql.NullTime
+	err := row.Scan(&tokens_valid_after)
+	return tokens_valid_after, err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, tokens_valid_after, role, suspended_at, totp_last_step
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const suspendUser = `-- name: SuspendUser :one
+UPDATE users SET suspended_at = COALESCE(suspended_at, NOW()), updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, tokens_valid_after, role, suspended_at, totp_last_step
+`
+
+func (q *Queries) SuspendUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, suspendUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :one
+UPDATE users SET suspended_at = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, tokens_valid_after, role, suspended_at, totp_last_step
+`
+
+func (q *Queries) UnsuspendUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, unsuspendUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.TotpLastStep,
 	)
 	return i, err
 }
 
 const updateUser = `-- name: UpdateUser :one
-UPDATE users SET email = $2, hashed_password = $3, updated_at = NOW()
+UPDATE users SET email = $2, hashed_password = $3, updated_at = NOW(),
+email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, tokens_valid_after, role, suspended_at, totp_last_step
 `
 
 type UpdateUserParams struct {
@@ -102,7 +379,49 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.TotpLastStep,
 	)
 	return i, err
 }
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE users SET totp_last_step = $1::bigint
+WHERE id = $2
+AND (totp_last_step IS NULL OR totp_last_step < $1::bigint)
+`
+
+type UseTOTPStepParams struct {
+	Step int64
+	ID   uuid.UUID
+}
+
+// UseTOTPStep records step as used. It affects no rows when a code from that
+// step or a later one was already accepted.
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.Step, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
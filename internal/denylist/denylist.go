@@ -0,0 +1,243 @@
+package denylist
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// Store is the part of database.Queries the denylist needs.
+type Store interface {
+	CreateRevokedAccessToken(ctx context.Context, arg database.CreateRevokedAccessTokenParams) error
+	ListActiveRevokedAccessTokens(ctx context.Context) ([]database.ListActiveRevokedAccessTokensRow, error)
+	DeleteExpiredRevokedAccessTokens(ctx context.Context) error
+	CreateRevokedSession(ctx context.Context, arg database.CreateRevokedSessionParams) error
+	ListActiveRevokedSessions(ctx context.Context) ([]database.ListActiveRevokedSessionsRow, error)
+	DeleteExpiredRevokedSessions(ctx context.Context) error
+	SetTokensValidAfter(ctx context.Context, id uuid.UUID) (sql.NullTime, error)
+	ListRecentTokensValidAfter(ctx context.Context, tokensValidAfter sql.NullTime) ([]database.ListRecentTokensValidAfterRow, error)
+}
+
+// Denylist implements auth.RevocationChecker with an in-memory copy of the
+// revoked_access_tokens and revoked_sessions tables and recent
+// users.tokens_valid_after values.
+//
+// Checks never hit Postgres directly. The copy is reloaded at most every
+// syncInterval, so a revocation made by another server instance takes up to
+// that long to apply here; revocations made through this instance apply
+// immediately. Revocations are never undone, so merging a reload with local
+// writes is always safe.
+type Denylist struct {
+	store        Store
+	syncInterval time.Duration
+	// maxTokenAge is the access token lifetime. A tokens_valid_after older
+	// than that can't reject any live token, so it isn't loaded.
+	maxTokenAge time.Duration
+	now         func() time.Time
+
+	syncMu sync.Mutex
+
+	mu              sync.RWMutex
+	revokedJTIs     map[string]time.Time    // jti -> token expiry
+	revokedSessions map[uuid.UUID]time.Time // sid -> expiry of its last token
+	validAfter      map[uuid.UUID]time.Time
+	lastSync        time.Time
+}
+
+var _ auth.RevocationChecker = (*Denylist)(nil)
+
+func New(store Store, syncInterval, maxTokenAge time.Duration) *Denylist {
+	return &Denylist{
+		store:           store,
+		syncInterval:    syncInterval,
+		maxTokenAge:     maxTokenAge,
+		now:             time.Now,
+		revokedJTIs:     map[string]time.Time{},
+		revokedSessions: map[uuid.UUID]time.Time{},
+		validAfter:      map[uuid.UUID]time.Time{},
+	}
+}
+
+func (d *Denylist) IsRevoked(ctx context.Context, principal auth.Principal) (bool, error) {
+	err := d.syncIfStale(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if _, ok := d.revokedJTIs[principal.TokenID]; ok {
+		return true, nil
+	}
+	if principal.SessionID != uuid.Nil {
+		if _, ok := d.revokedSessions[principal.SessionID]; ok {
+			return true, nil
+		}
+	}
+	if validAfter, ok := d.validAfter[principal.UserID]; ok && principal.IssuedAt.Before(validAfter) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// RevokeToken denylists a single access token until it expires.
+func (d *Denylist) RevokeToken(ctx context.Context, principal auth.Principal) error {
+	err := d.store.CreateRevokedAccessToken(ctx, database.CreateRevokedAccessTokenParams{
+		Jti:       principal.TokenID,
+		UserID:    principal.UserID,
+		ExpiresAt: principal.ExpiresAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.revokedJTIs[principal.TokenID] = principal.ExpiresAt
+	d.mu.Unlock()
+	return nil
+}
+
+// RevokeSession invalidates every access token issued from a session, i.e.
+// carrying it as their sid.
+func (d *Denylist) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	// No token issued from the session so far outlives this.
+	expiresAt := d.now().Add(d.maxTokenAge)
+	err := d.store.CreateRevokedSession(ctx, database.CreateRevokedSessionParams{
+		SessionID: sessionID,
+		UserID:    userID,
+		ExpiresAt: expiresAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.revokedSessions[sessionID] = expiresAt
+	d.mu.Unlock()
+	return nil
+}
+
+// RevokeAllForUser invalidates every access token issued to the user so far.
+func (d *Denylist) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	validAfter, err := d.store.SetTokensValidAfter(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.mergeValidAfter(userID, validAfter.Time)
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *Denylist) syncIfStale(ctx context.Context) error {
+	d.mu.RLock()
+	lastSync := d.lastSync
+	d.mu.RUnlock()
+	if d.now().Sub(lastSync) < d.syncInterval {
+		return nil
+	}
+
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+
+	// Another goroutine may have synced while we waited for the lock.
+	d.mu.RLock()
+	lastSync = d.lastSync
+	d.mu.RUnlock()
+	if d.now().Sub(lastSync) < d.syncInterval {
+		return nil
+	}
+
+	err := d.Sync(ctx)
+	if err != nil {
+		if lastSync.IsZero() {
+			return err
+		}
+		// A stale denylist beats rejecting every request while the
+		// database is unreachable.
+		log.Printf("Couldn't refresh access token denylist, using copy from %s: %s", lastSync.Format(time.RFC3339), err)
+	}
+	return nil
+}
+
+// Sync reloads the denylist from the store.
+func (d *Denylist) Sync(ctx context.Context) error {
+	now := d.now()
+
+	err := d.store.DeleteExpiredRevokedAccessTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := d.store.ListActiveRevokedAccessTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.store.DeleteExpiredRevokedSessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	revokedSessions, err := d.store.ListActiveRevokedSessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	validAfter, err := d.store.ListRecentTokensValidAfter(ctx, sql.NullTime{
+		Time:  now.Add(-d.maxTokenAge).UTC(),
+		Valid: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for jti, expiresAt := range d.revokedJTIs {
+		if !expiresAt.After(now) {
+			delete(d.revokedJTIs, jti)
+		}
+	}
+	for _, row := range revoked {
+		d.revokedJTIs[row.Jti] = row.ExpiresAt
+	}
+
+	for sessionID, expiresAt := range d.revokedSessions {
+		if !expiresAt.After(now) {
+			delete(d.revokedSessions, sessionID)
+		}
+	}
+	for _, row := range revokedSessions {
+		d.revokedSessions[row.SessionID] = row.ExpiresAt
+	}
+
+	for userID, t := range d.validAfter {
+		if t.Before(now.Add(-d.maxTokenAge)) {
+			delete(d.validAfter, userID)
+		}
+	}
+	for _, row := range validAfter {
+		d.mergeValidAfter(row.ID, row.TokensValidAfter.Time)
+	}
+
+	d.lastSync = now
+	return nil
+}
+
+// mergeValidAfter keeps the later of the cached and given timestamps. The
+// caller must hold d.mu.
+func (d *Denylist) mergeValidAfter(userID uuid.UUID, t time.Time) {
+	if current, ok := d.validAfter[userID]; !ok || t.After(current) {
+		d.validAfter[userID] = t
+	}
+}
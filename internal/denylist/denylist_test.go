@@ -0,0 +1,262 @@
+package denylist
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// fakeStore stands in for Postgres. It is shared between Denylists to mimic
+// several server instances.
+type fakeStore struct {
+	mu         sync.Mutex
+	revoked    map[string]time.Time
+	sessions   map[uuid.UUID]time.Time
+	validAfter map[uuid.UUID]time.Time
+	failReads  bool
+	reads      int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{revoked: map[string]time.Time{}, sessions: map[uuid.UUID]time.Time{}, validAfter: map[uuid.UUID]time.Time{}}
+}
+
+func (s *fakeStore) CreateRevokedAccessToken(ctx context.Context, arg database.CreateRevokedAccessTokenParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[arg.Jti] = arg.ExpiresAt
+	return nil
+}
+
+func (s *fakeStore) ListActiveRevokedAccessTokens(ctx context.Context) ([]database.ListActiveRevokedAccessTokensRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reads++
+	if s.failReads {
+		return nil, errors.New("database is down")
+	}
+	rows := []database.ListActiveRevokedAccessTokensRow{}
+	for jti, expiresAt := range s.revoked {
+		rows = append(rows, database.ListActiveRevokedAccessTokensRow{Jti: jti, ExpiresAt: expiresAt})
+	}
+	return rows, nil
+}
+
+func (s *fakeStore) DeleteExpiredRevokedAccessTokens(ctx context.Context) error {
+	return nil
+}
+
+func (s *fakeStore) CreateRevokedSession(ctx context.Context, arg database.CreateRevokedSessionParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[arg.SessionID] = arg.ExpiresAt
+	return nil
+}
+
+func (s *fakeStore) ListActiveRevokedSessions(ctx context.Context) ([]database.ListActiveRevokedSessionsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failReads {
+		return nil, errors.New("database is down")
+	}
+	rows := []database.ListActiveRevokedSessionsRow{}
+	for sessionID, expiresAt := range s.sessions {
+		rows = append(rows, database.ListActiveRevokedSessionsRow{SessionID: sessionID, ExpiresAt: expiresAt})
+	}
+	return rows, nil
+}
+
+func (s *fakeStore) DeleteExpiredRevokedSessions(ctx context.Context) error {
+	return nil
+}
+
+func (s *fakeStore) SetTokensValidAfter(ctx context.Context, id uuid.UUID) (sql.NullTime, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.validAfter[id] = now
+	return sql.NullTime{Time: now, Valid: true}, nil
+}
+
+func (s *fakeStore) ListRecentTokensValidAfter(ctx context.Context, since sql.NullTime) ([]database.ListRecentTokensValidAfterRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []database.ListRecentTokensValidAfterRow{}
+	for id, t := range s.validAfter {
+		if t.After(since.Time) {
+			rows = append(rows, database.ListRecentTokensValidAfterRow{ID: id, TokensValidAfter: sql.NullTime{Time: t, Valid: true}})
+		}
+	}
+	return rows, nil
+}
+
+// newPrincipal mimics a parsed JWT, whose iat_ms has millisecond precision.
+func newPrincipal(userID uuid.UUID, issuedAt time.Time) auth.Principal {
+	issuedAt = issuedAt.Truncate(time.Millisecond)
+	return auth.Principal{
+		UserID:    userID,
+		TokenID:   uuid.NewString(),
+		IssuedAt:  issuedAt,
+		ExpiresAt: issuedAt.Add(time.Hour),
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	d := New(store, time.Minute, time.Hour)
+
+	userID := uuid.New()
+	revokedToken := newPrincipal(userID, time.Now())
+	otherToken := newPrincipal(userID, time.Now())
+
+	if err := d.RevokeToken(ctx, revokedToken); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		want      bool
+	}{
+		{name: "Revoked jti", principal: revokedToken, want: true},
+		{name: "Other jti", principal: otherToken, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.IsRevoked(ctx, tt.principal)
+			if err != nil || got != tt.want {
+				t.Errorf("IsRevoked() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	if err := d.RevokeAllForUser(ctx, userID); err != nil {
+		t.Fatalf("RevokeAllForUser() error = %v", err)
+	}
+	if got, _ := d.IsRevoked(ctx, otherToken); !got {
+		t.Errorf("IsRevoked() = false for token issued before RevokeAllForUser")
+	}
+
+	// Tokens issued within the same second as the revocation are told apart
+	// by their millisecond issue time.
+	revokedAt := store.validAfter[userID]
+	validAfterTests := []struct {
+		name     string
+		issuedAt time.Time
+		want     bool
+	}{
+		{name: "Issued just before", issuedAt: revokedAt.Add(-time.Millisecond), want: true},
+		{name: "Issued just after", issuedAt: revokedAt.Add(time.Millisecond), want: false},
+		{name: "Issued a second after", issuedAt: revokedAt.Add(time.Second), want: false},
+	}
+	for _, tt := range validAfterTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.IsRevoked(ctx, newPrincipal(userID, tt.issuedAt))
+			if err != nil || got != tt.want {
+				t.Errorf("IsRevoked() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenylistRevokeSession(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	d := New(store, time.Minute, time.Hour)
+	remote := New(store, time.Minute, time.Hour)
+
+	userID := uuid.New()
+	sessionID := uuid.New()
+	if err := remote.RevokeSession(ctx, userID, sessionID); err != nil {
+		t.Fatalf("RevokeSession() error = %v", err)
+	}
+
+	sessionToken := newPrincipal(userID, time.Now())
+	sessionToken.SessionID = sessionID
+	otherSessionToken := newPrincipal(userID, time.Now())
+	otherSessionToken.SessionID = uuid.New()
+
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		want      bool
+	}{
+		{name: "Token from revoked session", principal: sessionToken, want: true},
+		{name: "Token from other session", principal: otherSessionToken, want: false},
+		{name: "Token without session", principal: newPrincipal(userID, time.Now()), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.IsRevoked(ctx, tt.principal)
+			if err != nil || got != tt.want {
+				t.Errorf("IsRevoked() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenylistSyncsFromOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	clock := time.Now()
+
+	local := New(store, time.Minute, time.Hour)
+	local.now = func() time.Time { return clock }
+	remote := New(store, time.Minute, time.Hour)
+
+	token := newPrincipal(uuid.New(), clock)
+	if got, _ := local.IsRevoked(ctx, token); got {
+		t.Fatalf("IsRevoked() = true before any revocation")
+	}
+
+	remote.RevokeToken(ctx, token)
+
+	reads := store.reads
+	if got, _ := local.IsRevoked(ctx, token); got {
+		t.Errorf("IsRevoked() = true before the sync interval elapsed")
+	}
+	if store.reads != reads {
+		t.Errorf("IsRevoked() hit the store within the sync interval")
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	if got, _ := local.IsRevoked(ctx, token); !got {
+		t.Errorf("IsRevoked() = false after sync picked up a remote revocation")
+	}
+}
+
+func TestDenylistStoreOutage(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	store.failReads = true
+	clock := time.Now()
+
+	d := New(store, time.Minute, time.Hour)
+	d.now = func() time.Time { return clock }
+
+	token := newPrincipal(uuid.New(), clock)
+	if _, err := d.IsRevoked(ctx, token); err == nil {
+		t.Errorf("IsRevoked() error = nil before the denylist was ever loaded")
+	}
+
+	store.failReads = false
+	d.RevokeToken(ctx, token)
+	if err := d.Sync(ctx); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	store.failReads = true
+	clock = clock.Add(2 * time.Minute)
+	got, err := d.IsRevoked(ctx, token)
+	if err != nil || !got {
+		t.Errorf("IsRevoked() = %v, %v during outage, want stale copy to answer true", got, err)
+	}
+}
@@ -0,0 +1,331 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// Enqueuer is the part of Store needed to add jobs. *database.Queries
+// satisfies it, including one bound to a transaction, so a job can be
+// enqueued atomically with the change that needs it.
+type Enqueuer interface {
+	EnqueueJob(ctx context.Context, arg database.EnqueueJobParams) (int64, error)
+}
+
+// Store is the subset of *database.Queries the queue needs.
+type Store interface {
+	Enqueuer
+	ClaimJobs(ctx context.Context, arg database.ClaimJobsParams) ([]database.Job, error)
+	DeleteJob(ctx context.Context, arg database.DeleteJobParams) (int64, error)
+	RetryJob(ctx context.Context, arg database.RetryJobParams) (int64, error)
+	KillJob(ctx context.Context, arg database.KillJobParams) (int64, error)
+}
+
+// Handler runs one job. A returned error is retried with back-off until the
+// job runs out of attempts, unless it is wrapped with Permanent.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Handle adapts a function taking a typed payload into a Handler. A payload
+// that doesn't decode into T fails the job permanently.
+func Handle[T any](fn func(ctx context.Context, payload T) error) Handler {
+	return func(ctx context.Context, raw json.RawMessage) error {
+		var payload T
+		err := json.Unmarshal(raw, &payload)
+		if err != nil {
+			return Permanent(fmt.Errorf("decoding payload: %w", err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying; the job goes straight to the
+// dead state.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// DefaultMaxAttempts is used when Options.MaxAttempts is zero.
+const DefaultMaxAttempts = 5
+
+// Options controls how a job is enqueued. The zero value runs the job as
+// soon as possible with DefaultMaxAttempts.
+type Options struct {
+	RunAt       time.Time
+	MaxAttempts int
+	// UniqueKey makes Enqueue a no-op while another pending or running job
+	// has the same key.
+	UniqueKey string
+}
+
+// Enqueue adds a job of the given kind. It reports false when UniqueKey
+// matched a job that is already queued.
+func Enqueue(ctx context.Context, store Enqueuer, kind string, payload any, opts Options) (bool, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return false, err
+	}
+
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.RunAt.IsZero() {
+		opts.RunAt = time.Now().UTC()
+	}
+
+	added, err := store.EnqueueJob(ctx, database.EnqueueJobParams{
+		Kind:        kind,
+		Payload:     raw,
+		MaxAttempts: int32(opts.MaxAttempts),
+		RunAt:       opts.RunAt.UTC(),
+		UniqueKey:   sql.NullString{String: opts.UniqueKey, Valid: opts.UniqueKey != ""},
+	})
+	return added > 0, err
+}
+
+// Config tunes a Queue.
+type Config struct {
+	// Workers is how many jobs run at once.
+	Workers int
+	// PollInterval is how long an idle worker waits before checking again.
+	PollInterval time.Duration
+	// Lease is how long a claimed job is locked for. A job still running
+	// after that may be picked up by another worker, so it should be well
+	// over the slowest handler.
+	Lease time.Duration
+	// BaseDelay is the wait before the first retry; each further failure
+	// doubles it, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Delay returns how long to wait before retrying a job that has failed
+// attempts times.
+func (c Config) Delay(attempts int) time.Duration {
+	delay := c.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= c.MaxDelay {
+			return c.MaxDelay
+		}
+	}
+	return delay
+}
+
+type schedule struct {
+	kind     string
+	interval time.Duration
+}
+
+// Queue runs jobs from the jobs table on a pool of workers. Any number of
+// server instances can share the table; claims use FOR UPDATE SKIP LOCKED
+// so each job goes to one worker.
+type Queue struct {
+	store     Store
+	cfg       Config
+	handlers  map[string]Handler
+	schedules []schedule
+	now       func() time.Time
+
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	jobsCtx context.Context
+	cancel  context.CancelFunc
+}
+
+func New(store Store, cfg Config) *Queue {
+	return &Queue{
+		store:    store,
+		cfg:      cfg,
+		handlers: map[string]Handler{},
+		now:      time.Now,
+	}
+}
+
+// Register sets the handler for kind. It must be called before Start.
+func (q *Queue) Register(kind string, handler Handler) {
+	q.handlers[kind] = handler
+}
+
+// Schedule enqueues a job of kind, with an empty payload, every interval.
+// Every server does this, but the job is keyed on its kind so only one is
+// queued at a time. It must be called before Start.
+func (q *Queue) Schedule(kind string, interval time.Duration) {
+	q.schedules = append(q.schedules, schedule{kind: kind, interval: interval})
+}
+
+// Enqueue adds a job using the queue's own store.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any, opts Options) (bool, error) {
+	return Enqueue(ctx, q.store, kind, payload, opts)
+}
+
+// Start launches the workers and schedules. Call Stop to drain them.
+func (q *Queue) Start() {
+	q.stop = make(chan struct{})
+	q.jobsCtx, q.cancel = context.WithCancel(context.Background())
+
+	for range q.cfg.Workers {
+		// Identifies the worker's leases, so it can't finish a job that
+		// another worker has claimed since.
+		workerID := uuid.NewString()
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.runWorker(workerID)
+		}()
+	}
+
+	for _, s := range q.schedules {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.runSchedule(s)
+		}()
+	}
+}
+
+// Stop stops claiming jobs and waits for running ones to finish. If ctx
+// ends first, running jobs have their context canceled and Stop returns
+// ctx's error; their locks lapse and another worker retries them.
+func (q *Queue) Stop(ctx context.Context) error {
+	close(q.stop)
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) runWorker(workerID string) {
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		ran, err := q.work(q.jobsCtx, workerID)
+		if err != nil {
+			log.Printf("Job queue: %s", err)
+		}
+		if ran {
+			continue
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-time.After(q.cfg.PollInterval):
+		}
+	}
+}
+
+func (q *Queue) runSchedule(s schedule) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			_, err := q.Enqueue(q.jobsCtx, s.kind, struct{}{}, Options{UniqueKey: s.kind})
+			if err != nil {
+				log.Printf("Job queue: couldn't schedule %s: %s", s.kind, err)
+			}
+		}
+	}
+}
+
+// work claims and runs a single job as workerID. ran is false when nothing
+// was due.
+func (q *Queue) work(ctx context.Context, workerID string) (ran bool, err error) {
+	lockedBy := sql.NullString{String: workerID, Valid: true}
+	claimed, err := q.store.ClaimJobs(ctx, database.ClaimJobsParams{
+		LockedUntil: sql.NullTime{Time: q.now().UTC().Add(q.cfg.Lease), Valid: true},
+		LockedBy:    lockedBy,
+		RowLimit:    1,
+	})
+	if err != nil {
+		return false, fmt.Errorf("claiming job: %w", err)
+	}
+	if len(claimed) == 0 {
+		return false, nil
+	}
+	job := claimed[0]
+
+	runErr := q.run(ctx, job)
+	finished, err := q.finish(ctx, job, lockedBy, runErr)
+	if err != nil {
+		return true, err
+	}
+	if finished == 0 {
+		return true, fmt.Errorf("%s job %s: lease lost before it finished; another worker may run it again", job.Kind, job.ID)
+	}
+	return true, nil
+}
+
+// finish deletes, retries or kills a job depending on how it ran. It
+// reports how many rows changed, which is 0 once the lease has been lost.
+func (q *Queue) finish(ctx context.Context, job database.Job, lockedBy sql.NullString, runErr error) (int64, error) {
+	if runErr == nil {
+		return q.store.DeleteJob(ctx, database.DeleteJobParams{ID: job.ID, LockedBy: lockedBy})
+	}
+
+	lastError := sql.NullString{String: runErr.Error(), Valid: true}
+	var permanent permanentError
+	if errors.As(runErr, &permanent) || job.Attempts >= job.MaxAttempts {
+		log.Printf("Job queue: %s job %s is dead after %d attempts: %s", job.Kind, job.ID, job.Attempts, runErr)
+		return q.store.KillJob(ctx, database.KillJobParams{ID: job.ID, LastError: lastError, LockedBy: lockedBy})
+	}
+
+	return q.store.RetryJob(ctx, database.RetryJobParams{
+		ID:        job.ID,
+		RunAt:     q.now().UTC().Add(q.cfg.Delay(int(job.Attempts))),
+		LastError: lastError,
+		LockedBy:  lockedBy,
+	})
+}
+
+// run calls the job's handler, turning a panic into an error so one bad
+// job can't take a worker down.
+func (q *Queue) run(ctx context.Context, job database.Job) (err error) {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for job kind %q", job.Kind))
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panicked: %v", p)
+		}
+	}()
+
+	return handler(ctx, job.Payload)
+}
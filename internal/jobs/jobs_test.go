@@ -0,0 +1,345 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// fakeStore keeps jobs in memory and only understands enough of the real
+// queries to drive Queue.
+type fakeStore struct {
+	mu   sync.Mutex
+	now  time.Time
+	jobs map[uuid.UUID]*database.Job
+}
+
+func newFakeStore(now time.Time) *fakeStore {
+	return &fakeStore{now: now, jobs: map[uuid.UUID]*database.Job{}}
+}
+
+func (s *fakeStore) EnqueueJob(ctx context.Context, arg database.EnqueueJobParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if arg.UniqueKey.Valid {
+		for _, job := range s.jobs {
+			if job.UniqueKey == arg.UniqueKey && job.Status != "dead" {
+				return 0, nil
+			}
+		}
+	}
+
+	id := uuid.New()
+	s.jobs[id] = &database.Job{
+		ID:          id,
+		Kind:        arg.Kind,
+		Payload:     arg.Payload,
+		Status:      "pending",
+		MaxAttempts: arg.MaxAttempts,
+		RunAt:       arg.RunAt,
+		UniqueKey:   arg.UniqueKey,
+	}
+	return 1, nil
+}
+
+func (s *fakeStore) ClaimJobs(ctx context.Context, arg database.ClaimJobsParams) ([]database.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.Status == "pending" && !job.RunAt.After(s.now) {
+			job.Status = "running"
+			job.Attempts++
+			job.LockedUntil = arg.LockedUntil
+			job.LockedBy = arg.LockedBy
+			return []database.Job{*job}, nil
+		}
+	}
+	return nil, nil
+}
+
+// leased returns the job if lockedBy still holds its lease. The caller must
+// hold s.mu.
+func (s *fakeStore) leased(id uuid.UUID, lockedBy sql.NullString) *database.Job {
+	job, ok := s.jobs[id]
+	if !ok || job.LockedBy != lockedBy || !job.LockedUntil.Time.After(s.now) {
+		return nil
+	}
+	return job
+}
+
+func (s *fakeStore) DeleteJob(ctx context.Context, arg database.DeleteJobParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leased(arg.ID, arg.LockedBy) == nil {
+		return 0, nil
+	}
+	delete(s.jobs, arg.ID)
+	return 1, nil
+}
+
+func (s *fakeStore) RetryJob(ctx context.Context, arg database.RetryJobParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.leased(arg.ID, arg.LockedBy)
+	if job == nil {
+		return 0, nil
+	}
+	job.Status = "pending"
+	job.RunAt = arg.RunAt
+	job.LastError = arg.LastError
+	job.LockedBy = sql.NullString{}
+	return 1, nil
+}
+
+func (s *fakeStore) KillJob(ctx context.Context, arg database.KillJobParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.leased(arg.ID, arg.LockedBy)
+	if job == nil {
+		return 0, nil
+	}
+	job.Status = "dead"
+	job.LastError = arg.LastError
+	job.LockedBy = sql.NullString{}
+	return 1, nil
+}
+
+// only returns the single job in the store.
+func (s *fakeStore) only(t *testing.T) *database.Job {
+	t.Helper()
+	if len(s.jobs) != 1 {
+		t.Fatalf("store has %d jobs, want 1", len(s.jobs))
+	}
+	for _, job := range s.jobs {
+		return job
+	}
+	return nil
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func TestQueueWork(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cfg := Config{Lease: time.Minute, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	errFlaky := errors.New("flaky")
+
+	tests := []struct {
+		name        string
+		handler     Handler
+		maxAttempts int
+		wantDeleted bool
+		wantStatus  string
+		wantRunAt   time.Time
+	}{
+		{
+			name: "Success deletes the job",
+			handler: Handle(func(ctx context.Context, g greeting) error {
+				if g.Name != "chirpy" {
+					return Permanent(errors.New("wrong payload"))
+				}
+				return nil
+			}),
+			wantDeleted: true,
+		},
+		{
+			name:       "Failure is retried with back-off",
+			handler:    func(ctx context.Context, _ json.RawMessage) error { return errFlaky },
+			wantStatus: "pending",
+			wantRunAt:  now.Add(time.Second),
+		},
+		{
+			name:        "Last attempt goes dead",
+			handler:     func(ctx context.Context, _ json.RawMessage) error { return errFlaky },
+			maxAttempts: 1,
+			wantStatus:  "dead",
+		},
+		{
+			name:       "Permanent failure goes dead",
+			handler:    func(ctx context.Context, _ json.RawMessage) error { return Permanent(errFlaky) },
+			wantStatus: "dead",
+		},
+		{
+			name: "Undecodable payload goes dead",
+			handler: Handle(func(ctx context.Context, n int) error {
+				return nil
+			}),
+			wantStatus: "dead",
+		},
+		{
+			name:       "Panic is retried",
+			handler:    func(ctx context.Context, _ json.RawMessage) error { panic("boom") },
+			wantStatus: "pending",
+			wantRunAt:  now.Add(time.Second),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore(now)
+			queue := New(store, cfg)
+			queue.now = func() time.Time { return now }
+			queue.Register("greet", tt.handler)
+
+			_, err := queue.Enqueue(context.Background(), "greet", greeting{Name: "chirpy"}, Options{RunAt: now, MaxAttempts: tt.maxAttempts})
+			if err != nil {
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+
+			ran, err := queue.work(context.Background(), "worker-1")
+			if err != nil || !ran {
+				t.Fatalf("work() = %v, %v, want true, nil", ran, err)
+			}
+
+			if tt.wantDeleted {
+				if len(store.jobs) != 0 {
+					t.Errorf("store has %d jobs, want 0", len(store.jobs))
+				}
+				return
+			}
+
+			job := store.only(t)
+			if job.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", job.Status, tt.wantStatus)
+			}
+			if !tt.wantRunAt.IsZero() && !job.RunAt.Equal(tt.wantRunAt) {
+				t.Errorf("run_at = %v, want %v", job.RunAt, tt.wantRunAt)
+			}
+			if !job.LastError.Valid {
+				t.Error("last_error not recorded")
+			}
+		})
+	}
+}
+
+func TestQueueWorkLeaseLost(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := newFakeStore(now)
+	queue := New(store, Config{Lease: time.Minute})
+	queue.now = func() time.Time { return now }
+
+	// The handler outlives its lease and another worker claims the job.
+	queue.Register("slow", func(ctx context.Context, _ json.RawMessage) error {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		for _, job := range store.jobs {
+			job.LockedBy = sql.NullString{String: "worker-2", Valid: true}
+		}
+		return nil
+	})
+
+	_, err := queue.Enqueue(context.Background(), "slow", nil, Options{RunAt: now})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	ran, err := queue.work(context.Background(), "worker-1")
+	if !ran || err == nil {
+		t.Fatalf("work() = %v, %v, want true and a lease lost error", ran, err)
+	}
+	if job := store.only(t); job.Status != "running" {
+		t.Errorf("status = %q, want running under the other worker's lease", job.Status)
+	}
+}
+
+func TestQueueWorkUnknownKind(t *testing.T) {
+	now := time.Now()
+	store := newFakeStore(now)
+	queue := New(store, Config{Lease: time.Minute})
+
+	_, err := queue.Enqueue(context.Background(), "mystery", nil, Options{RunAt: now})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	_, err = queue.work(context.Background(), "worker-1")
+	if err != nil {
+		t.Fatalf("work() error = %v", err)
+	}
+	if job := store.only(t); job.Status != "dead" {
+		t.Errorf("status = %q, want dead", job.Status)
+	}
+}
+
+func TestEnqueueUniqueKey(t *testing.T) {
+	store := newFakeStore(time.Now())
+
+	added, err := Enqueue(context.Background(), store, "sweep", nil, Options{UniqueKey: "sweep"})
+	if err != nil || !added {
+		t.Fatalf("first Enqueue() = %v, %v, want true, nil", added, err)
+	}
+
+	added, err = Enqueue(context.Background(), store, "sweep", nil, Options{UniqueKey: "sweep"})
+	if err != nil || added {
+		t.Fatalf("second Enqueue() = %v, %v, want false, nil", added, err)
+	}
+}
+
+func TestConfigDelay(t *testing.T) {
+	cfg := Config{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 4, want: 8 * time.Second},
+		{attempts: 5, want: 10 * time.Second},
+		{attempts: 50, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.Delay(tt.attempts); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestQueueStopDrains(t *testing.T) {
+	store := newFakeStore(time.Now())
+	queue := New(store, Config{Workers: 2, PollInterval: time.Millisecond, Lease: time.Minute})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	queue.Register("slow", func(ctx context.Context, _ json.RawMessage) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	_, err := queue.Enqueue(context.Background(), "slow", nil, Options{RunAt: store.now})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	queue.Start()
+	<-started
+
+	stopped := make(chan error)
+	go func() { stopped <- queue.Stop(context.Background()) }()
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop() returned while a job was still running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if len(store.jobs) != 0 {
+		t.Errorf("store has %d jobs after drain, want 0", len(store.jobs))
+	}
+}
@@ -0,0 +1,175 @@
+package loginthrottle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+// Scope says what a failure counter is keyed by.
+type Scope string
+
+const (
+	ScopeAccount Scope = "account"
+	ScopeIP      Scope = "ip"
+)
+
+// Store is the part of database.Queries the throttle needs.
+type Store interface {
+	GetLoginThrottle(ctx context.Context, arg database.GetLoginThrottleParams) (database.LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (int32, error)
+	SetLoginThrottleLockedUntil(ctx context.Context, arg database.SetLoginThrottleLockedUntilParams) error
+	DeleteLoginThrottle(ctx context.Context, arg database.DeleteLoginThrottleParams) (int64, error)
+}
+
+// Policy decides how long a subject is locked out after a failed login.
+type Policy struct {
+	// FreeAttempts failures are allowed before any lockout.
+	FreeAttempts int
+	// BaseDelay is the first lockout; each further failure doubles it.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// ResetAfter is how long without failures before the count restarts.
+	ResetAfter time.Duration
+}
+
+// Delay returns the lockout that follows the given number of consecutive
+// failures.
+func (p Policy) Delay(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < over; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Throttle counts failed logins per account and per client IP. Accounts are
+// keyed by the submitted email whether or not it belongs to a user, so a
+// lockout says nothing about which emails are registered.
+type Throttle struct {
+	store   Store
+	account Policy
+	ip      Policy
+	now     func() time.Time
+}
+
+func New(store Store, account, ip Policy) *Throttle {
+	return &Throttle{
+		store:   store,
+		account: account,
+		ip:      ip,
+		now:     time.Now,
+	}
+}
+
+// Check returns how long the caller has to wait before trying to log in, or
+// zero if they may try now.
+func (t *Throttle) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	wait := time.Duration(0)
+	for scope, subject := range t.subjects(email, ip) {
+		throttle, err := t.store.GetLoginThrottle(ctx, database.GetLoginThrottleParams{
+			Scope:   string(scope),
+			Subject: subject,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if throttle.LockedUntil.Valid {
+			wait = max(wait, throttle.LockedUntil.Time.Sub(t.now().UTC()))
+		}
+	}
+	return wait, nil
+}
+
+// RecordFailure counts a failed login against both the account and the IP.
+func (t *Throttle) RecordFailure(ctx context.Context, email, ip string) error {
+	for scope, subject := range t.subjects(email, ip) {
+		policy := t.policy(scope)
+		now := t.now().UTC()
+
+		failures, err := t.store.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Scope:       string(scope),
+			Subject:     subject,
+			ResetBefore: now.Add(-policy.ResetAfter),
+		})
+		if err != nil {
+			return err
+		}
+
+		delay := policy.Delay(int(failures))
+		if delay == 0 {
+			continue
+		}
+
+		err = t.store.SetLoginThrottleLockedUntil(ctx, database.SetLoginThrottleLockedUntilParams{
+			Scope:       string(scope),
+			Subject:     subject,
+			LockedUntil: sql.NullTime{Time: now.Add(delay), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordSuccess clears the account's failures. The IP's failures stay, or
+// an attacker could reset them by logging into an account of their own.
+func (t *Throttle) RecordSuccess(ctx context.Context, email string) error {
+	_, err := t.store.DeleteLoginThrottle(ctx, database.DeleteLoginThrottleParams{
+		Scope:   string(ScopeAccount),
+		Subject: normalizeEmail(email),
+	})
+	return err
+}
+
+// Unlock clears the failures and any lockout for an email or IP. It reports
+// whether there was anything to clear.
+func (t *Throttle) Unlock(ctx context.Context, scope Scope, subject string) (bool, error) {
+	if scope == ScopeAccount {
+		subject = normalizeEmail(subject)
+	}
+
+	deleted, err := t.store.DeleteLoginThrottle(ctx, database.DeleteLoginThrottleParams{
+		Scope:   string(scope),
+		Subject: subject,
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+func (t *Throttle) subjects(email, ip string) map[Scope]string {
+	return map[Scope]string{
+		ScopeAccount: normalizeEmail(email),
+		ScopeIP:      ip,
+	}
+}
+
+func (t *Throttle) policy(scope Scope) Policy {
+	if scope == ScopeIP {
+		return t.ip
+	}
+	return t.account
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
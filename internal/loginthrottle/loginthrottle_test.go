@@ -0,0 +1,129 @@
+package loginthrottle
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"githuv.com/grvbrk/go-server/internal/database"
+)
+
+type fakeStore struct {
+	rows map[database.GetLoginThrottleParams]database.LoginThrottle
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{rows: map[database.GetLoginThrottleParams]database.LoginThrottle{}}
+}
+
+func (s *fakeStore) GetLoginThrottle(ctx context.Context, arg database.GetLoginThrottleParams) (database.LoginThrottle, error) {
+	row, ok := s.rows[arg]
+	if !ok {
+		return database.LoginThrottle{}, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+func (s *fakeStore) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (int32, error) {
+	key := database.GetLoginThrottleParams{Scope: arg.Scope, Subject: arg.Subject}
+	row, ok := s.rows[key]
+	if !ok || row.LastFailedAt.Before(arg.ResetBefore) {
+		row = database.LoginThrottle{Scope: arg.Scope, Subject: arg.Subject}
+	}
+	row.Failures++
+	row.LastFailedAt = arg.ResetBefore.Add(time.Hour)
+	s.rows[key] = row
+	return row.Failures, nil
+}
+
+func (s *fakeStore) SetLoginThrottleLockedUntil(ctx context.Context, arg database.SetLoginThrottleLockedUntilParams) error {
+	key := database.GetLoginThrottleParams{Scope: arg.Scope, Subject: arg.Subject}
+	row := s.rows[key]
+	row.LockedUntil = arg.LockedUntil
+	s.rows[key] = row
+	return nil
+}
+
+func (s *fakeStore) DeleteLoginThrottle(ctx context.Context, arg database.DeleteLoginThrottleParams) (int64, error) {
+	key := database.GetLoginThrottleParams{Scope: arg.Scope, Subject: arg.Subject}
+	if _, ok := s.rows[key]; !ok {
+		return 0, nil
+	}
+	delete(s.rows, key)
+	return 1, nil
+}
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Second},
+		{failures: 5, want: 2 * time.Second},
+		{failures: 7, want: 8 * time.Second},
+		{failures: 8, want: 10 * time.Second},
+		{failures: 100, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Now()
+	account := Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, ResetAfter: time.Hour}
+	ip := Policy{FreeAttempts: 4, BaseDelay: time.Minute, MaxDelay: time.Hour, ResetAfter: time.Hour}
+
+	throttle := New(newFakeStore(), account, ip)
+	throttle.now = func() time.Time { return clock }
+
+	for i := 0; i < 2; i++ {
+		throttle.RecordFailure(ctx, "Walt@Example.com", "10.0.0.1")
+	}
+	if wait, _ := throttle.Check(ctx, "walt@example.com", "10.0.0.1"); wait != 0 {
+		t.Fatalf("Check() = %v within free attempts, want 0", wait)
+	}
+
+	throttle.RecordFailure(ctx, "walt@example.com", "10.0.0.1")
+	if wait, _ := throttle.Check(ctx, " WALT@example.com", "10.0.0.2"); wait != time.Minute {
+		t.Errorf("Check() = %v for locked account, want %v", wait, time.Minute)
+	}
+	if wait, _ := throttle.Check(ctx, "jesse@example.com", "10.0.0.2"); wait != 0 {
+		t.Errorf("Check() = %v for other account and IP, want 0", wait)
+	}
+
+	// Spreading guesses across accounts still trips the IP counter.
+	throttle.RecordFailure(ctx, "jesse@example.com", "10.0.0.1")
+	throttle.RecordFailure(ctx, "skyler@example.com", "10.0.0.1")
+	if wait, _ := throttle.Check(ctx, "hank@example.com", "10.0.0.1"); wait != time.Minute {
+		t.Errorf("Check() = %v for locked IP, want %v", wait, time.Minute)
+	}
+
+	throttle.RecordSuccess(ctx, "walt@example.com")
+	if wait, _ := throttle.Check(ctx, "walt@example.com", "10.0.0.2"); wait != 0 {
+		t.Errorf("Check() = %v after successful login, want 0", wait)
+	}
+
+	unlocked, err := throttle.Unlock(ctx, ScopeIP, "10.0.0.1")
+	if err != nil || !unlocked {
+		t.Fatalf("Unlock() = %v, %v, want true", unlocked, err)
+	}
+	if wait, _ := throttle.Check(ctx, "hank@example.com", "10.0.0.1"); wait != 0 {
+		t.Errorf("Check() = %v after unlock, want 0", wait)
+	}
+
+	clock = clock.Add(2 * time.Hour)
+	throttle.RecordFailure(ctx, "jesse@example.com", "10.0.0.3")
+	if wait, _ := throttle.Check(ctx, "jesse@example.com", "10.0.0.3"); wait != 0 {
+		t.Errorf("Check() = %v after failures were reset, want 0", wait)
+	}
+}
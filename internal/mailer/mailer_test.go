@@ -0,0 +1,169 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterMailer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	m := NewWriterMailer(buf, "chirpy@example.com")
+
+	err := m.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Hello\r\nBcc: evil@example.com",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"From: chirpy@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: HelloBcc: evil@example.com\r\n",
+		"line one\r\nline two\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Send() output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	tests := []struct {
+		name         string
+		from         string
+		wantMailFrom string
+		wantFrom     string
+	}{
+		{
+			name:         "Bare address",
+			from:         "chirpy@example.com",
+			wantMailFrom: "MAIL FROM:<chirpy@example.com>",
+			wantFrom:     "From: chirpy@example.com\r\n",
+		},
+		{
+			name:         "Display name",
+			from:         "Chirpy <no-reply@chirpy.local>",
+			wantMailFrom: "MAIL FROM:<no-reply@chirpy.local>",
+			wantFrom:     "From: Chirpy <no-reply@chirpy.local>\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, received := startFakeSMTPServer(t)
+			m := NewSMTPMailer(addr, tt.from, "", "")
+
+			err := m.Send(context.Background(), Message{
+				To:      "user@example.com",
+				Subject: "Reset your password",
+				Body:    "token: abc123",
+			})
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			select {
+			case msg := <-received:
+				if msg.MailFrom != tt.wantMailFrom {
+					t.Errorf("fake server got %q, want %q", msg.MailFrom, tt.wantMailFrom)
+				}
+				if !strings.Contains(msg.Data, tt.wantFrom) || !strings.Contains(msg.Data, "To: user@example.com") || !strings.Contains(msg.Data, "token: abc123") {
+					t.Errorf("fake server received unexpected message:\n%s", msg.Data)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("fake server never received a message")
+			}
+		})
+	}
+}
+
+func TestSMTPMailerInvalidSender(t *testing.T) {
+	m := NewSMTPMailer("127.0.0.1:0", "Chirpy", "", "")
+	err := m.Send(context.Background(), Message{To: "user@example.com"})
+	if err == nil {
+		t.Errorf("Send() error = nil for a sender without an address")
+	}
+}
+
+// fakeSMTPMessage is what the fake server saw of one message.
+type fakeSMTPMessage struct {
+	// MailFrom is the MAIL command exactly as sent.
+	MailFrom string
+	Data     string
+}
+
+// startFakeSMTPServer speaks just enough SMTP for net/smtp.SendMail and
+// hands back the envelope sender and DATA section of the first message it
+// receives.
+func startFakeSMTPServer(t *testing.T) (string, <-chan fakeSMTPMessage) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan fakeSMTPMessage, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost fake SMTP")
+		msg := fakeSMTPMessage{}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL"):
+				msg.MailFrom = strings.TrimSpace(line)
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				msg.Data = data.String()
+				received <- msg
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), received
+}
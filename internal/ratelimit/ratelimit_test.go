@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	clock := time.Now()
+	limiter := New()
+	limiter.now = func() time.Time { return clock }
+
+	limit := Limit{Requests: 3, Per: 3 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		res := limiter.Allow("ip:10.0.0.1", limit)
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d: Allow() = %+v, want allowed with %d remaining", i, res, 2-i)
+		}
+	}
+
+	res := limiter.Allow("ip:10.0.0.1", limit)
+	if res.Allowed || res.RetryAfter != time.Second {
+		t.Errorf("Allow() = %+v, want refused with 1s retry", res)
+	}
+
+	if res := limiter.Allow("ip:10.0.0.2", limit); !res.Allowed {
+		t.Errorf("Allow() refused a different key")
+	}
+
+	clock = clock.Add(time.Second)
+	if res := limiter.Allow("ip:10.0.0.1", limit); !res.Allowed {
+		t.Errorf("Allow() = %+v after a token refilled, want allowed", res)
+	}
+
+	// A higher limit on the same key only adds capacity as it refills.
+	higher := Limit{Requests: 30, Per: 3 * time.Second}
+	if res := limiter.Allow("ip:10.0.0.1", higher); res.Allowed {
+		t.Errorf("Allow() = %+v right after switching limits, want refused", res)
+	}
+	clock = clock.Add(time.Second)
+	if res := limiter.Allow("ip:10.0.0.1", higher); !res.Allowed || res.Remaining != 9 {
+		t.Errorf("Allow() = %+v, want allowed with 9 remaining", res)
+	}
+}
+
+func TestResultSetHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		res  Result
+		want map[string]string
+	}{
+		{
+			name: "Allowed",
+			res:  Result{Allowed: true, Limit: 10, Remaining: 4, ResetAfter: 1500 * time.Millisecond},
+			want: map[string]string{
+				"X-RateLimit-Limit":     "10",
+				"X-RateLimit-Remaining": "4",
+				"X-RateLimit-Reset":     "2",
+				"Retry-After":           "",
+			},
+		},
+		{
+			name: "Refused",
+			res:  Result{Limit: 10, RetryAfter: 300 * time.Millisecond, ResetAfter: 3 * time.Second},
+			want: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"Retry-After":           "1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			tt.res.SetHeaders(h)
+			for name, want := range tt.want {
+				if got := h.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
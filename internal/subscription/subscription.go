@@ -0,0 +1,109 @@
+package subscription
+
+import (
+	"errors"
+	"time"
+)
+
+// Status is the state of a Chirpy Red subscription.
+type Status string
+
+const (
+	// StatusActive renews at the end of the period.
+	StatusActive Status = "active"
+	// StatusCanceled won't renew, but stays paid for until the period ends.
+	StatusCanceled Status = "canceled"
+	StatusExpired  Status = "expired"
+	StatusRefunded Status = "refunded"
+)
+
+// Event is a Polka webhook event about a subscription.
+type Event string
+
+const (
+	EventUpgraded   Event = "user.upgraded"
+	EventRenewed    Event = "user.renewed"
+	EventCanceled   Event = "user.canceled"
+	EventDowngraded Event = "user.downgraded"
+	EventRefunded   Event = "user.refunded"
+)
+
+// DefaultPeriod is used when Polka doesn't say when a period ends.
+const DefaultPeriod = 30 * 24 * time.Hour
+
+var ErrUnknownEvent = errors.New("unknown subscription event")
+
+// KnownEvent reports whether Apply understands event.
+func KnownEvent(event Event) bool {
+	switch event {
+	case EventUpgraded, EventRenewed, EventCanceled, EventDowngraded, EventRefunded:
+		return true
+	}
+	return false
+}
+
+// State is a subscription's status and the end of its current period.
+type State struct {
+	Status    Status
+	PeriodEnd time.Time
+}
+
+// IsChirpyRed reports whether the subscription grants Chirpy Red at now.
+// Canceled subscriptions do until their period runs out.
+func (s State) IsChirpyRed(now time.Time) bool {
+	return (s.Status == StatusActive || s.Status == StatusCanceled) && s.PeriodEnd.After(now)
+}
+
+// Apply returns the state after event. current is nil for a user who has
+// never subscribed, and periodEnd is the period end Polka reported, or zero.
+// changed is false when the event has nothing to act on, such as canceling
+// a subscription that already lapsed.
+func Apply(current *State, event Event, periodEnd, now time.Time) (next State, changed bool, err error) {
+	switch event {
+	case EventUpgraded:
+		end := periodEnd
+		if end.IsZero() {
+			end = now.Add(DefaultPeriod)
+		}
+		// An upgrade while still paid up mustn't cut the period short.
+		if current != nil && current.IsChirpyRed(now) && current.PeriodEnd.After(end) {
+			end = current.PeriodEnd
+		}
+		return State{Status: StatusActive, PeriodEnd: end}, true, nil
+
+	case EventRenewed:
+		end := periodEnd
+		if end.IsZero() {
+			start := now
+			if current != nil && current.IsChirpyRed(now) {
+				start = current.PeriodEnd
+			}
+			end = start.Add(DefaultPeriod)
+		}
+		return State{Status: StatusActive, PeriodEnd: end}, true, nil
+
+	case EventCanceled:
+		if current == nil || current.Status != StatusActive {
+			return State{}, false, nil
+		}
+		return State{Status: StatusCanceled, PeriodEnd: current.PeriodEnd}, true, nil
+
+	case EventDowngraded:
+		if current == nil || !current.IsChirpyRed(now) {
+			return State{}, false, nil
+		}
+		return State{Status: StatusExpired, PeriodEnd: now}, true, nil
+
+	case EventRefunded:
+		if current == nil || current.Status == StatusRefunded {
+			return State{}, false, nil
+		}
+		end := current.PeriodEnd
+		if end.After(now) {
+			end = now
+		}
+		return State{Status: StatusRefunded, PeriodEnd: end}, true, nil
+	}
+
+	return State{}, false, ErrUnknownEvent
+}
@@ -0,0 +1,155 @@
+package subscription
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	reported := now.Add(7 * 24 * time.Hour)
+	later := now.Add(60 * 24 * time.Hour)
+	past := now.Add(-time.Hour)
+
+	active := &State{Status: StatusActive, PeriodEnd: later}
+	canceled := &State{Status: StatusCanceled, PeriodEnd: later}
+	lapsed := &State{Status: StatusExpired, PeriodEnd: past}
+	refunded := &State{Status: StatusRefunded, PeriodEnd: past}
+
+	tests := []struct {
+		name        string
+		current     *State
+		event       Event
+		periodEnd   time.Time
+		want        State
+		wantChanged bool
+		wantErr     error
+	}{
+		{
+			name:        "First upgrade without period end",
+			event:       EventUpgraded,
+			want:        State{Status: StatusActive, PeriodEnd: now.Add(DefaultPeriod)},
+			wantChanged: true,
+		},
+		{
+			name:        "First upgrade with period end",
+			event:       EventUpgraded,
+			periodEnd:   reported,
+			want:        State{Status: StatusActive, PeriodEnd: reported},
+			wantChanged: true,
+		},
+		{
+			name:        "Upgrade keeps a later paid-up period",
+			current:     canceled,
+			event:       EventUpgraded,
+			periodEnd:   reported,
+			want:        State{Status: StatusActive, PeriodEnd: later},
+			wantChanged: true,
+		},
+		{
+			name:        "Renewal extends from the period end",
+			current:     active,
+			event:       EventRenewed,
+			want:        State{Status: StatusActive, PeriodEnd: later.Add(DefaultPeriod)},
+			wantChanged: true,
+		},
+		{
+			name:        "Renewal after lapse starts now",
+			current:     lapsed,
+			event:       EventRenewed,
+			want:        State{Status: StatusActive, PeriodEnd: now.Add(DefaultPeriod)},
+			wantChanged: true,
+		},
+		{
+			name:        "Cancel keeps the period",
+			current:     active,
+			event:       EventCanceled,
+			want:        State{Status: StatusCanceled, PeriodEnd: later},
+			wantChanged: true,
+		},
+		{
+			name:    "Cancel without subscription",
+			event:   EventCanceled,
+			wantErr: nil,
+		},
+		{
+			name:    "Cancel twice",
+			current: canceled,
+			event:   EventCanceled,
+		},
+		{
+			name:        "Downgrade ends now",
+			current:     canceled,
+			event:       EventDowngraded,
+			want:        State{Status: StatusExpired, PeriodEnd: now},
+			wantChanged: true,
+		},
+		{
+			name:    "Downgrade after lapse",
+			current: lapsed,
+			event:   EventDowngraded,
+		},
+		{
+			name:        "Refund ends now",
+			current:     active,
+			event:       EventRefunded,
+			want:        State{Status: StatusRefunded, PeriodEnd: now},
+			wantChanged: true,
+		},
+		{
+			name:        "Refund after lapse keeps the old end",
+			current:     lapsed,
+			event:       EventRefunded,
+			want:        State{Status: StatusRefunded, PeriodEnd: past},
+			wantChanged: true,
+		},
+		{
+			name:    "Refund twice",
+			current: refunded,
+			event:   EventRefunded,
+		},
+		{
+			name:    "Unknown event",
+			current: active,
+			event:   Event("user.exploded"),
+			wantErr: ErrUnknownEvent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := Apply(tt.current, tt.event, tt.periodEnd, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Apply() error = %v, want %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("Apply() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if changed && (got.Status != tt.want.Status || !got.PeriodEnd.Equal(tt.want.PeriodEnd)) {
+				t.Errorf("Apply() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsChirpyRed(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		state State
+		want  bool
+	}{
+		{state: State{Status: StatusActive, PeriodEnd: now.Add(time.Hour)}, want: true},
+		{state: State{Status: StatusCanceled, PeriodEnd: now.Add(time.Hour)}, want: true},
+		{state: State{Status: StatusActive, PeriodEnd: now.Add(-time.Hour)}, want: false},
+		{state: State{Status: StatusRefunded, PeriodEnd: now.Add(time.Hour)}, want: false},
+		{state: State{Status: StatusExpired, PeriodEnd: now.Add(time.Hour)}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.state.IsChirpyRed(now); got != tt.want {
+			t.Errorf("%+v.IsChirpyRed() = %v, want %v", tt.state, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Headers set on every outbound delivery.
+const (
+	EventHeader     = "X-Chirpy-Event"
+	DeliveryHeader  = "X-Chirpy-Delivery"
+	TimestampHeader = "X-Chirpy-Timestamp"
+	SignatureHeader = "X-Chirpy-Signature"
+)
+
+var ErrPrivateAddress = errors.New("refusing to deliver to a private address")
+
+// StatusError is returned when a receiver answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("receiver responded with %d", e.StatusCode)
+}
+
+// Delivery is one signed POST to a receiver.
+type Delivery struct {
+	ID     string
+	Event  string
+	URL    string
+	Secret []byte
+	Body   []byte
+}
+
+// Sender posts signed deliveries. Unless AllowPrivateNetworks is set it
+// won't connect to loopback, private, link-local, carrier-grade NAT or other
+// special-purpose addresses, so endpoints can't be pointed at our own
+// infrastructure.
+type Sender struct {
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewSender(timeout time.Duration, allowPrivateNetworks bool) *Sender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivateNetworks {
+		dialer.Control = refusePrivateAddresses
+	}
+
+	return &Sender{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: timeout,
+			},
+			// A redirect would skip the signature check on the other end
+			// and could lead anywhere.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		now: time.Now,
+	}
+}
+
+// Send posts d and returns the receiver's status code. The error is a
+// *StatusError for non-2xx responses; the status code is 0 if the request
+// never got a response.
+func (s *Sender) Send(ctx context.Context, d Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := s.now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, d.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(d.Secret, timestamp, d.Body))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// Drain a little so the connection can be reused; receivers shouldn't
+	// be sending much back.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, &StatusError{StatusCode: res.StatusCode}
+	}
+	return res.StatusCode, nil
+}
+
+// blockedPrefixes are special-purpose ranges that the netip.Addr checks in
+// blockedAddress don't cover but that can still reach internal hosts.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+}
+
+func refusePrivateAddresses(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if blockedAddress(addrPort.Addr()) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// blockedAddress reports whether ip must not be delivered to. An
+// IPv4-mapped IPv6 address is judged by the IPv4 address it carries.
+func blockedAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryPolicy spaces out attempts at a failing delivery, doubling the wait
+// each time, and gives up after MaxAttempts.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Next returns how long to wait after the given number of failed attempts,
+// and false once the delivery should be given up on.
+func (p RetryPolicy) Next(attempts int) (time.Duration, bool) {
+	if attempts >= p.MaxAttempts {
+		return 0, false
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay, true
+		}
+	}
+	return delay, true
+}
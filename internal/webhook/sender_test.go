@@ -0,0 +1,176 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestSenderSend(t *testing.T) {
+	secret := []byte("endpoint-secret")
+	body := []byte(`{"type":"chirp.created"}`)
+
+	var gotErr error
+	var gotEvent, gotDelivery string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEvent = r.Header.Get(EventHeader)
+		gotDelivery = r.Header.Get(DeliveryHeader)
+		raw, _ := io.ReadAll(r.Body)
+		gotErr = NewVerifier(time.Minute, secret).Verify(r.Header.Get(SignatureHeader), r.Header.Get(TimestampHeader), raw)
+		if gotErr != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+
+	sender := NewSender(5*time.Second, true)
+	status, err := sender.Send(context.Background(), Delivery{
+		ID:     "delivery-1",
+		Event:  "chirp.created",
+		URL:    receiver.URL,
+		Secret: secret,
+		Body:   body,
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if status != http.StatusAccepted {
+		t.Errorf("Send() status = %d, want %d", status, http.StatusAccepted)
+	}
+	if gotErr != nil {
+		t.Errorf("receiver couldn't verify signature: %v", gotErr)
+	}
+	if gotEvent != "chirp.created" || gotDelivery != "delivery-1" {
+		t.Errorf("receiver got event %q delivery %q", gotEvent, gotDelivery)
+	}
+}
+
+func TestSenderSendFailures(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, failing.URL, http.StatusFound)
+	}))
+	defer redirecting.Close()
+
+	tests := []struct {
+		name       string
+		sender     *Sender
+		url        string
+		wantStatus int
+		wantErr    func(error) bool
+	}{
+		{
+			name:       "Receiver error",
+			sender:     NewSender(5*time.Second, true),
+			url:        failing.URL,
+			wantStatus: http.StatusInternalServerError,
+			wantErr: func(err error) bool {
+				var statusErr *StatusError
+				return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusInternalServerError
+			},
+		},
+		{
+			name:       "Redirect isn't followed",
+			sender:     NewSender(5*time.Second, true),
+			url:        redirecting.URL,
+			wantStatus: http.StatusFound,
+			wantErr: func(err error) bool {
+				var statusErr *StatusError
+				return errors.As(err, &statusErr)
+			},
+		},
+		{
+			name:       "Loopback refused",
+			sender:     NewSender(5*time.Second, false),
+			url:        failing.URL,
+			wantStatus: 0,
+			wantErr:    func(err error) bool { return errors.Is(err, ErrPrivateAddress) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := tt.sender.Send(context.Background(), Delivery{
+				ID:     "delivery-1",
+				Event:  "chirp.created",
+				URL:    tt.url,
+				Secret: []byte("secret"),
+				Body:   []byte("{}"),
+			})
+			if status != tt.wantStatus {
+				t.Errorf("Send() status = %d, want %d", status, tt.wantStatus)
+			}
+			if !tt.wantErr(err) {
+				t.Errorf("Send() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestBlockedAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: false},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", want: false},
+		{ip: "127.0.0.1", want: true},
+		{ip: "10.1.2.3", want: true},
+		{ip: "169.254.169.254", want: true},
+		{ip: "0.0.0.0", want: true},
+		{ip: "0.1.2.3", want: true},
+		{ip: "100.64.0.1", want: true},
+		{ip: "100.127.255.254", want: true},
+		{ip: "100.128.0.1", want: false},
+		{ip: "192.0.0.170", want: true},
+		{ip: "198.18.0.1", want: true},
+		{ip: "::1", want: true},
+		{ip: "fd00::1", want: true},
+		{ip: "fe80::1", want: true},
+		{ip: "::ffff:127.0.0.1", want: true},
+		{ip: "::ffff:10.0.0.1", want: true},
+		{ip: "::ffff:100.64.0.1", want: true},
+		{ip: "::ffff:192.0.0.8", want: true},
+		{ip: "::ffff:93.184.216.34", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := blockedAddress(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("blockedAddress(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyNext(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: 5 * time.Minute}
+
+	tests := []struct {
+		attempts  int
+		wantDelay time.Duration
+		wantRetry bool
+	}{
+		{attempts: 1, wantDelay: time.Minute, wantRetry: true},
+		{attempts: 2, wantDelay: 2 * time.Minute, wantRetry: true},
+		{attempts: 3, wantDelay: 4 * time.Minute, wantRetry: true},
+		{attempts: 4, wantDelay: 5 * time.Minute, wantRetry: true},
+		{attempts: 5, wantRetry: false},
+	}
+
+	for _, tt := range tests {
+		delay, retry := policy.Next(tt.attempts)
+		if delay != tt.wantDelay || retry != tt.wantRetry {
+			t.Errorf("Next(%d) = %v, %v, want %v, %v", tt.attempts, delay, retry, tt.wantDelay, tt.wantRetry)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package webhook
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifier(t *testing.T) {
+	now := time.Unix(1718000000, 0)
+	body := []byte(`{"event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	oldSecret := []byte("old-secret")
+	newSecret := []byte("new-secret")
+
+	verifier := NewVerifier(5*time.Minute, oldSecret, newSecret)
+	verifier.now = func() time.Time { return now }
+
+	unix := func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) }
+
+	tests := []struct {
+		name      string
+		signature string
+		timestamp string
+		body      []byte
+		wantErr   error
+	}{
+		{
+			name:      "Signed with new secret",
+			signature: Sign(newSecret, now, body),
+			timestamp: unix(now),
+			body:      body,
+		},
+		{
+			name:      "Signed with old secret during rotation",
+			signature: Sign(oldSecret, now, body),
+			timestamp: unix(now),
+			body:      body,
+		},
+		{
+			name:      "Prefixed signature",
+			signature: "sha256=" + Sign(newSecret, now, body),
+			timestamp: unix(now),
+			body:      body,
+		},
+		{
+			name:      "Unknown secret",
+			signature: Sign([]byte("someone-else"), now, body),
+			timestamp: unix(now),
+			body:      body,
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "Tampered body",
+			signature: Sign(newSecret, now, body),
+			timestamp: unix(now),
+			body:      []byte(`{"event":"user.upgraded","data":{"user_id":"00000000-0000-0000-0000-000000000000"}}`),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "Replayed with a fresh timestamp",
+			signature: Sign(newSecret, now.Add(-time.Hour), body),
+			timestamp: unix(now),
+			body:      body,
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "Stale timestamp",
+			signature: Sign(newSecret, now.Add(-6*time.Minute), body),
+			timestamp: unix(now.Add(-6 * time.Minute)),
+			body:      body,
+			wantErr:   ErrTimestampExpired,
+		},
+		{
+			name:      "Timestamp from the future",
+			signature: Sign(newSecret, now.Add(6*time.Minute), body),
+			timestamp: unix(now.Add(6 * time.Minute)),
+			body:      body,
+			wantErr:   ErrTimestampExpired,
+		},
+		{
+			name:      "Malformed timestamp",
+			signature: Sign(newSecret, now, body),
+			timestamp: "yesterday",
+			body:      body,
+			wantErr:   ErrInvalidTimestamp,
+		},
+		{
+			name:      "Missing signature",
+			timestamp: unix(now),
+			body:      body,
+			wantErr:   ErrMissingSignature,
+		},
+		{
+			name:      "Missing timestamp",
+			signature: Sign(newSecret, now, body),
+			body:      body,
+			wantErr:   ErrMissingTimestamp,
+		},
+		{
+			name:      "Signature isn't hex",
+			signature: "not-hex",
+			timestamp: unix(now),
+			body:      body,
+			wantErr:   ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.Verify(tt.signature, tt.timestamp, tt.body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"githuv.com/grvbrk/go-server/internal/database"
+	"githuv.com/grvbrk/go-server/internal/jobs"
+)
+
+// Background job kinds as stored in jobs.kind.
+const (
+	jobSendVerificationEmail  = "send_verification_email"
+	jobSendPasswordResetEmail = "send_password_reset_email"
+	jobDeliverWebhook         = "deliver_webhook"
+	jobExpireSubscriptions    = "expire_subscriptions"
+	jobPurgeDeadJobs          = "purge_dead_jobs"
+	jobPurgeDeletedChirps     = "purge_deleted_chirps"
+)
+
+var jobQueueConfig = jobs.Config{
+	Workers:      4,
+	PollInterval: time.Second,
+	Lease:        5 * time.Minute,
+	BaseDelay:    10 * time.Second,
+	MaxDelay:     30 * time.Minute,
+}
+
+const (
+	// jobDrainTimeout is how long shutdown waits for running jobs.
+	jobDrainTimeout = 30 * time.Second
+	// deadJobRetention is how long dead jobs are kept for inspection.
+	deadJobRetention = 30 * 24 * time.Hour
+)
+
+type userJob struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type deliverWebhookJob struct {
+	DeliveryID uuid.UUID `json:"delivery_id"`
+}
+
+// registerJobs sets up the handlers and periodic jobs on q.
+func (cfg *apiConfig) registerJobs(q *jobs.Queue) {
+	q.Register(jobSendVerificationEmail, jobs.Handle(cfg.runSendVerificationEmail))
+	q.Register(jobSendPasswordResetEmail, jobs.Handle(cfg.runSendPasswordResetEmail))
+	q.Register(jobDeliverWebhook, jobs.Handle(cfg.runDeliverWebhook))
+	q.Register(jobExpireSubscriptions, jobs.Handle(cfg.runExpireSubscriptions))
+	q.Register(jobPurgeDeadJobs, jobs.Handle(cfg.runPurgeDeadJobs))
+	q.Register(jobPurgeDeletedChirps, jobs.Handle(cfg.runPurgeDeletedChirps))
+
+	q.Schedule(jobExpireSubscriptions, subscriptionExpiryInterval)
+	q.Schedule(jobPurgeDeadJobs, time.Hour)
+	q.Schedule(jobPurgeDeletedChirps, time.Hour)
+}
+
+func (cfg *apiConfig) runSendVerificationEmail(ctx context.Context, job userJob) error {
+	user, err := cfg.db.GetUserByID(ctx, job.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	// Verified while the job was queued.
+	if user.EmailVerifiedAt.Valid {
+		return nil
+	}
+	return cfg.sendVerificationEmail(ctx, user)
+}
+
+func (cfg *apiConfig) runSendPasswordResetEmail(ctx context.Context, job userJob) error {
+	user, err := cfg.db.GetUserByID(ctx, job.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	return cfg.sendPasswordResetEmail(ctx, user)
+}
+
+// runDeliverWebhook makes one attempt at a delivery. Delivery failures are
+// the receiver's problem and follow webhookRetryPolicy with a fresh job;
+// only our own errors fail the job.
+func (cfg *apiConfig) runDeliverWebhook(ctx context.Context, job deliverWebhookJob) error {
+	delivery, err := cfg.db.GetWebhookDelivery(ctx, job.DeliveryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// The endpoint was deleted.
+			return nil
+		}
+		return err
+	}
+
+	if delivery.Status != "pending" {
+		return nil
+	}
+
+	delivery, err = cfg.attemptWebhookDelivery(ctx, delivery)
+	if err != nil {
+		return err
+	}
+
+	if delivery.Status == "pending" {
+		return queueWebhookDelivery(ctx, cfg.db, delivery)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) runExpireSubscriptions(ctx context.Context, _ struct{}) error {
+	n, err := cfg.expireSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Expired %d subscriptions", n)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) runPurgeDeadJobs(ctx context.Context, _ struct{}) error {
+	_, err := cfg.db.PurgeDeadJobs(ctx, time.Now().UTC().Add(-deadJobRetention))
+	return err
+}
+
+func (cfg *apiConfig) runPurgeDeletedChirps(ctx context.Context, _ struct{}) error {
+	cutoff := chirpPurgeCutoff(time.Now().UTC())
+	n, err := cfg.db.PurgeDeletedChirps(ctx, sql.NullTime{Time: cutoff, Valid: true})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Purged %d deleted chirps", n)
+	}
+	return nil
+}
+
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	MaxAttempts int32           `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   *string         `json:"last_error"`
+}
+
+// Admin_ListJobsHandler pages through jobs with the given status, dead by
+// default, newest first.
+func (cfg *apiConfig) Admin_ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	status := query.Get("status")
+	if status == "" {
+		status = "dead"
+	}
+	if status != "pending" && status != "running" && status != "dead" {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "status must be pending, running or dead", nil)
+		return
+	}
+
+	limit, err := parsePageLimit(query)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error(), err)
+		return
+	}
+
+	params := database.ListJobsParams{
+		Status:   status,
+		RowLimit: int32(limit + 1),
+	}
+	if cursorString := query.Get("cursor"); cursorString != "" {
+		cursor, err := decodeCursor(cursorString)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid cursor", err)
+			return
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	jobRows, err := cfg.db.ListJobs(r.Context(), params)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't fetch jobs", err)
+		return
+	}
+
+	nextCursor := ""
+	if len(jobRows) > limit {
+		jobRows = jobRows[:limit]
+		last := jobRows[len(jobRows)-1]
+		nextCursor = encodeCursor(keysetCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	// Response initiated ---
+	jobResponses := []Job{}
+	for _, job := range jobRows {
+		jobResponse := Job{
+			ID:          job.ID,
+			CreatedAt:   job.CreatedAt,
+			Kind:        job.Kind,
+			Payload:     job.Payload,
+			Status:      job.Status,
+			Attempts:    job.Attempts,
+			MaxAttempts: job.MaxAttempts,
+			RunAt:       job.RunAt,
+		}
+		if job.LastError.Valid {
+			jobResponse.LastError = &job.LastError.String
+		}
+		jobResponses = append(jobResponses, jobResponse)
+	}
+
+	if nextCursor != "" {
+		w.Header().Set("X-Next-Cursor", nextCursor)
+		w.Header().Set("Link", nextPageLink(r.URL, nextCursor))
+	}
+	respondWithJSON(w, http.StatusOK, jobResponses)
+}
+
+// Admin_RetryJobHandler puts a dead job back in the queue with its attempts
+// reset.
+func (cfg *apiConfig) Admin_RetryJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid job ID", err)
+		return
+	}
+
+	requeued, err := cfg.db.RequeueDeadJob(r.Context(), jobID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, r, http.StatusConflict, errCodeConflict, "The same job is already queued", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, errCodeInternal, "Couldn't requeue job", err)
+		return
+	}
+
+	if requeued == 0 {
+		respondWithError(w, r, http.StatusNotFound, errCodeNotFound, "Dead job not found", nil)
+		return
+	}
+
+	// Response initiated ---
+	w.WriteHeader(http.StatusAccepted)
+}
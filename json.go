@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Machine-readable error codes returned in the `code` field of an
+// errorResponse. Clients should branch on these rather than on the message.
+const (
+	errCodeInvalidJSON    = "invalid_json"
+	errCodeInvalidRequest = "invalid_request"
+	errCodeUnauthorized   = "unauthorized"
+	errCodeForbidden      = "forbidden"
+	errCodeNotFound       = "not_found"
+	errCodeEmailTaken     = "email_taken"
+	errCodeInternal       = "internal_error"
+	errCodeConflict       = "conflict"
+
+	errCodeRefreshTokenReused = "refresh_token_reused"
+	errCodeInvalidToken       = "invalid_token"
+	errCodeEmailUnverified    = "email_unverified"
+	errCodeAlreadyVerified    = "already_verified"
+
+	errCodeTwoFactorEnabled     = "two_factor_enabled"
+	errCodeInvalidTwoFactorCode = "invalid_two_factor_code"
+
+	errCodeTooManyAttempts = "too_many_attempts"
+	errCodeRateLimited     = "rate_limited"
+
+	errCodeAccountSuspended = "account_suspended"
+	errCodeInvalidSignature = "invalid_signature"
+	errCodeEditWindowClosed = "edit_window_closed"
+)
+
+// errorResponse is the body of every non-2xx JSON response:
+//
+//	{
+//	  "error": {
+//	    "code": "invalid_json",
+//	    "message": "Request body is not valid JSON",
+//	    "request_id": "5b0f..."
+//	  }
+//	}
+//
+// request_id matches the X-Request-ID response header and the server logs.
+type errorResponse struct {
+	Error errorObject `json:"error"`
+}
+
+type errorObject struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	resDataJSON, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(resDataJSON)
+}
+
+// respondWithError writes the error envelope. err is only logged, never sent
+// to the client.
+func respondWithError(w http.ResponseWriter, r *http.Request, code int, errCode, msg string, err error) {
+	requestID := requestIDFromContext(r.Context())
+	if err != nil {
+		log.Printf("[%s] %s: %s", requestID, msg, err)
+	} else if code >= 500 {
+		log.Printf("[%s] %s", requestID, msg)
+	}
+
+	respondWithJSON(w, code, errorResponse{
+		Error: errorObject{
+			Code:      errCode,
+			Message:   msg,
+			RequestID: requestID,
+		},
+	})
+}
+
+// decodeJSONBody reads the whole request body into dst. A non-nil error
+// means the client sent something we can't parse and should get a 400.
+func decodeJSONBody(r *http.Request, dst interface{}) error {
+	reqBodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(reqBodyBytes) == 0 {
+		return errors.New("empty request body")
+	}
+	return json.Unmarshal(reqBodyBytes, dst)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespondWithError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		errCode string
+		msg     string
+		err     error
+	}{
+		{name: "Conflict", status: http.StatusConflict, errCode: errCodeConflict, msg: "The same job is already queued", err: errors.New("duplicate key value")},
+		{name: "Not found", status: http.StatusNotFound, errCode: errCodeNotFound, msg: "Chirp not found"},
+		{name: "Internal", status: http.StatusInternalServerError, errCode: errCodeInternal, msg: "Couldn't fetch chirp", err: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			respondWithError(w, httptest.NewRequest(http.MethodGet, "/", nil), tt.status, tt.errCode, tt.msg, tt.err)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			got := errorResponse{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not an error envelope: %v", w.Body.String(), err)
+			}
+			// err is for the logs only.
+			if got.Error.Code != tt.errCode || got.Error.Message != tt.msg {
+				t.Errorf("error = %+v, want code %q and message %q", got.Error, tt.errCode, tt.msg)
+			}
+		})
+	}
+}
@@ -1,23 +1,53 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/mail"
 	"os"
+	"os/signal"
+	"strings"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"githuv.com/grvbrk/go-server/internal/auth"
 	"githuv.com/grvbrk/go-server/internal/database"
+	"githuv.com/grvbrk/go-server/internal/denylist"
+	"githuv.com/grvbrk/go-server/internal/jobs"
+	"githuv.com/grvbrk/go-server/internal/loginthrottle"
+	"githuv.com/grvbrk/go-server/internal/mailer"
+	"githuv.com/grvbrk/go-server/internal/ratelimit"
+	"githuv.com/grvbrk/go-server/internal/webhook"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
+	dbConn         *sql.DB
 	platform       string
-	jwt_secret     string
-	polka_key      string
+	jwt_keys       *auth.KeySet
+	polka_verifier *webhook.Verifier
+	webhookSender  *webhook.Sender
+	jobs           *jobs.Queue
+	authenticator  *auth.Authenticator
+	denylist       *denylist.Denylist
+	loginThrottle  *loginthrottle.Throttle
+	rateLimiter    *ratelimit.Limiter
+	mailer         mailer.Mailer
+	base_url       string
+
+	// Unverified users can't post chirps when set.
+	require_email_verification bool
+	// How long after posting a chirp its author can still edit it.
+	chirpEditWindow time.Duration
 }
 
 func main() {
@@ -25,8 +55,31 @@ func main() {
 	godotenv.Load()
 	dbURL := os.Getenv("DB_URL")
 	platform := os.Getenv("PLATFORM")
-	jwt_secret := os.Getenv("JWT_SECRET")
-	polka_key := os.Getenv("POLKA_KEY")
+	// Comma-separated so a new secret can be added before the old one is
+	// retired.
+	polka_secrets := [][]byte{}
+	for _, secret := range strings.Split(os.Getenv("POLKA_WEBHOOK_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			polka_secrets = append(polka_secrets, []byte(secret))
+		}
+	}
+	if len(polka_secrets) == 0 {
+		log.Printf("POLKA_WEBHOOK_SECRETS not set; all Polka webhooks will be rejected")
+	}
+	require_email_verification := os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+	chirpEditWindow := defaultChirpEditWindow
+	if window := os.Getenv("CHIRP_EDIT_WINDOW"); window != "" {
+		parsed, err := time.ParseDuration(window)
+		if err != nil {
+			fmt.Printf("Error: CHIRP_EDIT_WINDOW: %v", err)
+			os.Exit(1)
+		}
+		chirpEditWindow = parsed
+	}
+	base_url := os.Getenv("BASE_URL")
+	if base_url == "" {
+		base_url = "http://localhost:8080"
+	}
 
 	db, err := sql.Open("postgres", dbURL)
 
@@ -37,37 +90,250 @@ func main() {
 
 	dbQueries := database.New(db)
 
+	if email := os.Getenv("BOOTSTRAP_ADMIN_EMAIL"); email != "" {
+		err = bootstrapAdmin(context.Background(), dbQueries, email)
+		if err != nil {
+			log.Printf("Couldn't bootstrap admin: %s", err)
+		}
+	}
+
+	jwt_keys, err := loadJWTKeys(platform)
+	if err != nil {
+		fmt.Printf("Error %v", err)
+		os.Exit(1)
+	}
+
+	appMailer, err := newMailerFromEnv()
+	if err != nil {
+		fmt.Printf("Error %v", err)
+		os.Exit(1)
+	}
+
+	// Revoked access tokens are cached in memory and reloaded every 30s.
+	accessTokenDenylist := denylist.New(dbQueries, 30*time.Second, accessTokenTTL)
+
 	mux := http.NewServeMux()
 	apiCfg := apiConfig{
 		fileserverHits: atomic.Int32{},
 		db:             dbQueries,
+		dbConn:         db,
 		platform:       platform,
-		jwt_secret:     jwt_secret,
-		polka_key:      polka_key,
+		jwt_keys:       jwt_keys,
+		polka_verifier: webhook.NewVerifier(polkaSignatureTolerance, polka_secrets...),
+		// Dev servers can deliver to receivers on localhost.
+		webhookSender: webhook.NewSender(webhookDeliveryTimeout, platform == "dev"),
+		mailer:        appMailer,
+		base_url:      base_url,
+		denylist:      accessTokenDenylist,
+		loginThrottle: loginthrottle.New(dbQueries, accountLoginPolicy, ipLoginPolicy),
+		rateLimiter:   ratelimit.New(),
+
+		require_email_verification: require_email_verification,
+		chirpEditWindow:            chirpEditWindow,
+		authenticator: &auth.Authenticator{
+			Keys:        jwt_keys,
+			Revocations: accessTokenDenylist,
+			Roles: func(ctx context.Context, userID uuid.UUID) (auth.Role, error) {
+				user, err := dbQueries.GetUserByID(ctx, userID)
+				return auth.Role(user.Role), err
+			},
+			Unauthorized: func(w http.ResponseWriter, r *http.Request, err error) {
+				respondWithError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Couldn't validate access token", err)
+			},
+			Forbidden: func(w http.ResponseWriter, r *http.Request, err error) {
+				respondWithError(w, r, http.StatusForbidden, errCodeForbidden, "You don't have permission to do that", err)
+			},
+		},
 	}
+	requireAuth := apiCfg.authenticator.RequireAuth
+	requireAdmin := apiCfg.authenticator.RequireRole(auth.RoleAdmin)
+	requireModerator := apiCfg.authenticator.RequireRole(auth.RoleModerator)
+	rateLimit := apiCfg.middlewareRateLimit
+
+	apiCfg.jobs = jobs.New(dbQueries, jobQueueConfig)
+	apiCfg.registerJobs(apiCfg.jobs)
 
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(".")))))
 	mux.HandleFunc("GET /api/healthz", apiCfg.HealthCheckHandler)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.Admin_GetNumberOfHitsHandler)
-	mux.HandleFunc("POST /admin/reset", apiCfg.Admin_ResetNumberOfHitsHandler)
-	mux.HandleFunc("POST /api/users", apiCfg.CreateUserHandler)
-	mux.HandleFunc("POST /api/chirps", apiCfg.CreateChirpHandler)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.JWKSHandler)
+	mux.Handle("GET /admin/metrics", requireAdmin(http.HandlerFunc(apiCfg.Admin_GetNumberOfHitsHandler)))
+	mux.Handle("POST /admin/reset", requireAdmin(http.HandlerFunc(apiCfg.Admin_ResetNumberOfHitsHandler)))
+	mux.Handle("POST /admin/login/unlock", requireAdmin(http.HandlerFunc(apiCfg.Admin_UnlockLoginHandler)))
+	mux.Handle("PUT /admin/users/{userID}/role", requireAdmin(http.HandlerFunc(apiCfg.Admin_SetUserRoleHandler)))
+	mux.Handle("GET /admin/audit-events", requireAdmin(http.HandlerFunc(apiCfg.Admin_ListAuditEventsHandler)))
+	mux.Handle("GET /admin/jobs", requireAdmin(http.HandlerFunc(apiCfg.Admin_ListJobsHandler)))
+	mux.Handle("POST /admin/jobs/{jobID}/retry", requireAdmin(http.HandlerFunc(apiCfg.Admin_RetryJobHandler)))
+	mux.Handle("POST /api/users", rateLimit("create_user", createUserRateLimit)(http.HandlerFunc(apiCfg.CreateUserHandler)))
+	mux.Handle("POST /api/chirps", requireAuth(rateLimit("create_chirp", createChirpRateLimit)(http.HandlerFunc(apiCfg.CreateChirpHandler))))
 	mux.HandleFunc("GET /api/chirps", apiCfg.GetChirpsInAsc)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.GetChirpById)
-	mux.HandleFunc("POST /api/login", apiCfg.LoginUser)
+	mux.Handle("PUT /api/chirps/{chirpID}", requireAuth(rateLimit("edit_chirp", createChirpRateLimit)(http.HandlerFunc(apiCfg.UpdateChirpHandler))))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/history", apiCfg.GetChirpHistoryHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/replies", apiCfg.GetChirpRepliesHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.GetChirpThreadHandler)
+	mux.Handle("POST /api/login", rateLimit("login", loginRateLimit)(http.HandlerFunc(apiCfg.LoginUser)))
+	mux.Handle("POST /api/login/2fa", rateLimit("login", loginRateLimit)(http.HandlerFunc(apiCfg.LoginTwoFactorHandler)))
 	mux.HandleFunc("POST /api/refresh", apiCfg.RefreshTokenHandler)
 	mux.HandleFunc("POST /api/revoke", apiCfg.RefreshTokenRevokeHandler)
-	mux.HandleFunc("PUT /api/users", apiCfg.UpdateUserCredsHandler)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.DeleteChirpByIdHandler)
+	mux.Handle("POST /api/logout", requireAuth(http.HandlerFunc(apiCfg.LogoutHandler)))
+	mux.Handle("POST /api/logout/all", requireAuth(http.HandlerFunc(apiCfg.LogoutAllHandler)))
+	mux.Handle("PUT /api/users", requireAuth(http.HandlerFunc(apiCfg.UpdateUserCredsHandler)))
+	mux.Handle("DELETE /api/chirps/{chirpID}", requireAuth(http.HandlerFunc(apiCfg.DeleteChirpByIdHandler)))
+	mux.Handle("POST /api/chirps/{chirpID}/restore", requireAuth(http.HandlerFunc(apiCfg.RestoreChirpHandler)))
+	mux.Handle("POST /api/chirps/{chirpID}/rechirp", requireAuth(rateLimit("rechirp", createChirpRateLimit)(http.HandlerFunc(apiCfg.RechirpHandler))))
+	mux.Handle("DELETE /api/chirps/{chirpID}/rechirp", requireAuth(http.HandlerFunc(apiCfg.UndoRechirpHandler)))
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.WebhookHandler)
+	mux.Handle("GET /api/subscription", requireAuth(http.HandlerFunc(apiCfg.GetSubscriptionHandler)))
+	mux.Handle("POST /api/webhooks", requireAuth(http.HandlerFunc(apiCfg.CreateWebhookEndpointHandler)))
+	mux.Handle("GET /api/webhooks", requireAuth(http.HandlerFunc(apiCfg.ListWebhookEndpointsHandler)))
+	mux.Handle("DELETE /api/webhooks/{endpointID}", requireAuth(http.HandlerFunc(apiCfg.DeleteWebhookEndpointHandler)))
+	mux.Handle("POST /api/webhooks/{endpointID}/test", requireAuth(http.HandlerFunc(apiCfg.TestWebhookEndpointHandler)))
+	mux.Handle("GET /api/webhooks/{endpointID}/deliveries", requireAuth(http.HandlerFunc(apiCfg.ListWebhookDeliveriesHandler)))
+	mux.Handle("POST /api/webhooks/{endpointID}/deliveries/{deliveryID}/redeliver", requireAuth(http.HandlerFunc(apiCfg.RedeliverWebhookHandler)))
+	mux.HandleFunc("GET /api/users/verify", apiCfg.VerifyEmailHandler)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.VerifyEmailHandler)
+	mux.Handle("POST /api/users/verify/resend", requireAuth(http.HandlerFunc(apiCfg.ResendVerificationHandler)))
+	mux.Handle("POST /api/password-reset/request", rateLimit("password_reset", passwordResetRateLimit)(http.HandlerFunc(apiCfg.PasswordResetRequestHandler)))
+	mux.HandleFunc("POST /api/password-reset/confirm", apiCfg.PasswordResetConfirmHandler)
+	mux.Handle("POST /api/2fa/enroll", requireAuth(http.HandlerFunc(apiCfg.TwoFactorEnrollHandler)))
+	mux.Handle("POST /api/2fa/confirm", requireAuth(http.HandlerFunc(apiCfg.TwoFactorConfirmHandler)))
+	mux.Handle("POST /api/2fa/disable", requireAuth(http.HandlerFunc(apiCfg.TwoFactorDisableHandler)))
+	mux.Handle("GET /api/sessions", requireAuth(http.HandlerFunc(apiCfg.ListSessionsHandler)))
+	mux.Handle("DELETE /api/sessions", requireAuth(http.HandlerFunc(apiCfg.RevokeOtherSessionsHandler)))
+	mux.Handle("DELETE /api/sessions/{sessionID}", requireAuth(http.HandlerFunc(apiCfg.RevokeSessionHandler)))
+	mux.Handle("POST /api/moderation/chirps/{chirpID}/remove", requireModerator(http.HandlerFunc(apiCfg.Moderator_RemoveChirpHandler)))
+	mux.Handle("POST /api/moderation/chirps/{chirpID}/restore", requireModerator(http.HandlerFunc(apiCfg.Moderator_RestoreChirpHandler)))
+	mux.Handle("POST /api/moderation/users/{userID}/suspend", requireModerator(http.HandlerFunc(apiCfg.Moderator_SuspendUserHandler)))
+	mux.Handle("POST /api/moderation/users/{userID}/unsuspend", requireModerator(http.HandlerFunc(apiCfg.Moderator_UnsuspendUserHandler)))
+	mux.Handle("GET /api/moderation/users/{userID}/chirps", requireModerator(http.HandlerFunc(apiCfg.Moderator_ListUserChirpsHandler)))
+	mux.Handle("GET /api/moderation/users/{userID}/actions", requireModerator(http.HandlerFunc(apiCfg.Moderator_ListUserActionsHandler)))
 
 	appServer := &http.Server{
 		Addr:    ":8080",
-		Handler: mux,
+		Handler: middlewareRequestID(rateLimit("default", defaultRateLimit)(mux)),
 	}
 
-	fmt.Printf("Server is starting on port %v \n", appServer.Addr)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	apiCfg.jobs.Start()
+
+	go func() {
+		fmt.Printf("Server is starting on port %v \n", appServer.Addr)
+		err := appServer.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Server stopped: %s", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down")
+
+	// Stop taking requests first so nothing new is queued while the workers
+	// drain.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), jobDrainTimeout)
+	defer cancel()
+	err = appServer.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("Couldn't shut down server cleanly: %s", err)
+	}
 
-	appServer.ListenAndServe()
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), jobDrainTimeout)
+	defer cancelDrain()
+	err = apiCfg.jobs.Stop(drainCtx)
+	if err != nil {
+		log.Printf("Couldn't drain job queue: %s", err)
+	}
+}
+
+// newMailerFromEnv picks the Mailer from MAILER: "smtp" relays through
+// SMTP_ADDR, "file" appends to MAILER_FILE, anything else prints to stdout.
+func newMailerFromEnv() (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("MAIL_FROM is not a valid address: %w", err)
+	}
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, fmt.Errorf("MAILER=smtp requires SMTP_ADDR")
+		}
+		return mailer.NewSMTPMailer(addr, from, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD")), nil
+	case "file":
+		path := os.Getenv("MAILER_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("MAILER=file requires MAILER_FILE")
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return mailer.NewWriterMailer(f, from), nil
+	default:
+		return mailer.NewWriterMailer(os.Stdout, from), nil
+	}
+}
+
+// loadJWTKeys reads the signing keys from JWT_KEYS_DIR and signs with
+// JWT_SIGNING_KID. A dev server without keys gets a throwaway Ed25519 key, so
+// its tokens stop working on restart.
+func loadJWTKeys(platform string) (*auth.KeySet, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if platform != "dev" {
+			return nil, fmt.Errorf("JWT_KEYS_DIR is required outside dev")
+		}
+		key, err := auth.GenerateEd25519Key("dev-" + time.Now().UTC().Format("20060102150405"))
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("JWT_KEYS_DIR not set; signing with ephemeral key %s", key.ID)
+		return auth.NewKeySet(key.ID, key)
+	}
+
+	return auth.LoadKeySet(dir, os.Getenv("JWT_SIGNING_KID"))
+}
+
+// bootstrapAdmin promotes the user with the given email to admin, but only
+// while there are no admins at all and only once that email is verified.
+// Once the first admin exists, roles are managed through
+// PUT /admin/users/{userID}/role.
+func bootstrapAdmin(ctx context.Context, db *database.Queries, email string) error {
+	admins, err := db.CountUsersWithRole(ctx, string(auth.RoleAdmin))
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	user, err := db.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no user with email %s; sign up and restart the server", email)
+	}
+	if err != nil {
+		return err
+	}
+	// Anyone can sign up with an unverified address, so only the owner of
+	// the mailbox may become the first admin.
+	if !user.EmailVerifiedAt.Valid {
+		return fmt.Errorf("%s hasn't verified their email; verify it and restart the server", email)
+	}
+
+	_, err = db.SetUserRole(ctx, database.SetUserRoleParams{
+		ID:   user.ID,
+		Role: string(auth.RoleAdmin),
+	})
+	if err != nil {
+		return err
+	}
 
+	log.Printf("Promoted %s to admin", email)
+	return nil
 }
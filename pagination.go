@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// keysetCursor is the (created_at, id) position of the last row on a page.
+// It is handed to clients as an opaque base64 string.
+type keysetCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func encodeCursor(c keysetCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (keysetCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return keysetCursor{}, errors.New("malformed cursor")
+	}
+
+	createdAtString, idString, found := strings.Cut(string(raw), "|")
+	if !found {
+		return keysetCursor{}, errors.New("malformed cursor")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtString)
+	if err != nil {
+		return keysetCursor{}, errors.New("malformed cursor")
+	}
+
+	id, err := uuid.Parse(idString)
+	if err != nil {
+		return keysetCursor{}, errors.New("malformed cursor")
+	}
+
+	return keysetCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// parsePageLimit reads the `limit` query param, falling back to
+// defaultPageLimit when it is absent.
+func parsePageLimit(query url.Values) (int, error) {
+	limitString := query.Get("limit")
+	if limitString == "" {
+		return defaultPageLimit, nil
+	}
+
+	limit, err := strconv.Atoi(limitString)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		return 0, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+	}
+	return limit, nil
+}
+
+// nextPageLink builds an RFC 8288 Link header value pointing at the page
+// after the current one, keeping every other query param intact.
+func nextPageLink(u *url.URL, cursor string) string {
+	query := u.Query()
+	query.Set("cursor", cursor)
+	next := url.URL{Path: u.Path, RawQuery: query.Encode()}
+	return "<" + next.String() + `>; rel="next"`
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := uuid.New()
+
+	tests := []struct {
+		name      string
+		createdAt time.Time
+	}{
+		{name: "UTC", createdAt: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "Microseconds", createdAt: time.Date(2024, 6, 1, 12, 0, 0, 123456000, time.UTC)},
+		{name: "Other zone", createdAt: time.Date(2024, 6, 1, 12, 0, 0, 0, time.FixedZone("IST", 5*60*60+30*60))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeCursor(keysetCursor{CreatedAt: tt.createdAt, ID: id})
+			got, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if !got.CreatedAt.Equal(tt.createdAt) || got.ID != id {
+				t.Errorf("decodeCursor() = %+v, want {%v %v}", got, tt.createdAt, id)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorMalformed(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "Not base64", cursor: "!!!"},
+		{name: "No separator", cursor: encode("2024-06-01T12:00:00Z")},
+		{name: "Bad time", cursor: encode("yesterday|" + uuid.NewString())},
+		{name: "Bad ID", cursor: encode("2024-06-01T12:00:00Z|not-a-uuid")},
+		{name: "Empty", cursor: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor); err == nil {
+				t.Errorf("decodeCursor(%q) error = nil, want error", tt.cursor)
+			}
+		})
+	}
+}
+
+func TestParsePageLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   string
+		want    int
+		wantErr bool
+	}{
+		{name: "Absent", limit: "", want: defaultPageLimit},
+		{name: "Smallest", limit: "1", want: 1},
+		{name: "Largest", limit: "200", want: maxPageLimit},
+		{name: "Zero", limit: "0", wantErr: true},
+		{name: "Negative", limit: "-5", wantErr: true},
+		{name: "Too large", limit: "201", wantErr: true},
+		{name: "Not a number", limit: "ten", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{}
+			if tt.limit != "" {
+				query.Set("limit", tt.limit)
+			}
+			got, err := parsePageLimit(query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePageLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parsePageLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextPageLink(t *testing.T) {
+	u, _ := url.Parse("/api/chirps?author_id=abc&limit=10&cursor=old")
+
+	got := nextPageLink(u, "new")
+	want := `</api/chirps?author_id=abc&cursor=new&limit=10>; rel="next"`
+	if got != want {
+		t.Errorf("nextPageLink() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"githuv.com/grvbrk/go-server/internal/auth"
+	"githuv.com/grvbrk/go-server/internal/ratelimit"
+)
+
+// routeLimit is a route's rate limit for each tier. Requests are counted per
+// user on authenticated routes and per client IP everywhere else, so the
+// Chirpy Red tier only applies to authenticated routes.
+type routeLimit struct {
+	standard  ratelimit.Limit
+	chirpyRed ratelimit.Limit
+}
+
+func sameForAllTiers(limit ratelimit.Limit) routeLimit {
+	return routeLimit{standard: limit, chirpyRed: limit}
+}
+
+var (
+	// defaultRateLimit applies to every request, per IP, on top of any
+	// route's own limit.
+	defaultRateLimit = sameForAllTiers(ratelimit.Limit{Requests: 300, Per: time.Minute})
+
+	createUserRateLimit    = sameForAllTiers(ratelimit.Limit{Requests: 10, Per: time.Hour})
+	loginRateLimit         = sameForAllTiers(ratelimit.Limit{Requests: 20, Per: time.Minute})
+	passwordResetRateLimit = sameForAllTiers(ratelimit.Limit{Requests: 5, Per: time.Hour})
+	createChirpRateLimit   = routeLimit{
+		standard:  ratelimit.Limit{Requests: 10, Per: time.Minute},
+		chirpyRed: ratelimit.Limit{Requests: 60, Per: time.Minute},
+	}
+)
+
+// middlewareRateLimit refuses requests over the route's limit with 429 and
+// sets X-RateLimit-* headers on every response. route names the bucket, so
+// routes sharing a name share a limit.
+func (cfg *apiConfig) middlewareRateLimit(route string, limit routeLimit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := route + "|ip:" + clientIP(r)
+			tierLimit := limit.standard
+
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if ok {
+				key = route + "|user:" + principal.UserID.String()
+				if limit.chirpyRed != limit.standard {
+					isChirpyRed, err := cfg.db.IsChirpyRed(r.Context(), principal.UserID)
+					if err == nil && isChirpyRed {
+						tierLimit = limit.chirpyRed
+					}
+				}
+			}
+
+			res := cfg.rateLimiter.Allow(key, tierLimit)
+			res.SetHeaders(w.Header())
+			if !res.Allowed {
+				respondWithError(w, r, http.StatusTooManyRequests, errCodeRateLimited, "Rate limit exceeded, try again later", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,25 +1,178 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, kind, quote_of)
 VALUES (
-gen_random_uuid(), NOW(), NOW(), $1, $2
+gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5
 )
 RETURNING *;
 
 -- name: GetAllChirpsInAsc :many
 SELECT *
 FROM chirps
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC;
 
+-- name: ListChirpsAsc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.narg('author_id')::uuid IS NOT NULL OR kind <> 'rechirp')
+AND (
+    rechirp_of IS NULL
+    OR EXISTS (SELECT 1 FROM chirps original WHERE original.id = chirps.rechirp_of AND original.deleted_at IS NULL)
+)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListChirpsDesc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.narg('author_id')::uuid IS NOT NULL OR kind <> 'rechirp')
+AND (
+    rechirp_of IS NULL
+    OR EXISTS (SELECT 1 FROM chirps original WHERE original.id = chirps.rechirp_of AND original.deleted_at IS NULL)
+)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
 -- name: GetChirpById :one
 SELECT *
 FROM chirps
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
 
--- name: DeleteChirpById :exec
-DELETE FROM chirps
-WHERE id = $1;
+-- name: GetChirpByIdForUpdate :one
+SELECT *
+FROM chirps
+WHERE id = $1 AND deleted_at IS NULL
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps SET body = $2,
+edited_at = NOW(),
+updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: SoftDeleteChirp :execrows
+UPDATE chirps SET deleted_at = NOW(),
+deleted_by = $2,
+updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetDeletedChirpForUpdate :one
+SELECT *
+FROM chirps
+WHERE id = $1 AND deleted_at IS NOT NULL
+FOR UPDATE;
 
--- name: UpgradeToChirpyRed :one
-UPDATE users SET is_chirpy_red = true, updated_at = NOW()
+-- name: RestoreChirp :one
+UPDATE chirps SET deleted_at = NULL,
+deleted_by = NULL,
+updated_at = NOW()
 WHERE id = $1
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1;
+
+-- name: ListChirpReplies :many
+SELECT *
+FROM chirps
+WHERE in_reply_to = sqlc.arg('parent_id')::uuid AND deleted_at IS NULL
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: CountChirpReplies :many
+SELECT in_reply_to::uuid AS chirp_id, COUNT(*) AS reply_count
+FROM chirps
+WHERE in_reply_to = ANY(sqlc.arg('chirp_ids')::uuid[]) AND deleted_at IS NULL
+GROUP BY in_reply_to;
+
+-- name: ListChirpAncestors :many
+-- ListChirpAncestors returns the chain of chirps a chirp replies to, root first.
+-- It stops at the first deleted ancestor.
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.in_reply_to, 1 AS depth
+    FROM chirps parent
+    JOIN chirps child ON child.in_reply_to = parent.id
+    WHERE child.id = $1 AND parent.deleted_at IS NULL
+    UNION ALL
+    SELECT c.id, c.in_reply_to, a.depth + 1
+    FROM chirps c
+    JOIN ancestors a ON c.id = a.in_reply_to
+    WHERE c.deleted_at IS NULL
+)
+SELECT c.*
+FROM chirps c
+JOIN ancestors a ON a.id = c.id
+ORDER BY a.depth DESC;
+
+-- name: ListChirpDescendants :many
+-- ListChirpDescendants returns the replies under a chirp down to max_depth,
+-- a level at a time, so a truncated result never has a reply without its
+-- parent. Replies under a deleted chirp are left out.
+WITH RECURSIVE descendants AS (
+    SELECT id, 1 AS depth
+    FROM chirps
+    WHERE in_reply_to = sqlc.arg('root_id')::uuid AND deleted_at IS NULL
+    UNION ALL
+    SELECT c.id, d.depth + 1
+    FROM chirps c
+    JOIN descendants d ON c.in_reply_to = d.id
+    WHERE c.deleted_at IS NULL AND d.depth < sqlc.arg('max_depth')::int
+)
+SELECT c.*
+FROM chirps c
+JOIN descendants d ON d.id = c.id
+ORDER BY d.depth, c.created_at, c.id
+LIMIT sqlc.arg('row_limit');
+
+-- name: GetChirpsByIds :many
+SELECT *
+FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]) AND deleted_at IS NULL;
+
+-- name: CreateRechirp :one
+-- CreateRechirp returns sql.ErrNoRows when the user has already rechirped the
+-- chirp.
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, kind, rechirp_of)
+VALUES (
+gen_random_uuid(), NOW(), NOW(), '', $1, 'rechirp', $2
+)
+ON CONFLICT (user_id, rechirp_of) WHERE kind = 'rechirp' DO NOTHING
+RETURNING *;
+
+-- name: GetRechirpForUser :one
+-- GetRechirpForUser includes a rechirp a moderator removed, which still
+-- blocks the user from rechirping the chirp again.
+SELECT *
+FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2 AND kind = 'rechirp';
+
+-- name: DeleteRechirpForUser :one
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2 AND kind = 'rechirp' AND deleted_at IS NULL
+RETURNING *;
+
+-- name: ListUserChirpsForModeration :many
+SELECT *
+FROM chirps
+WHERE user_id = sqlc.arg('user_id')
+AND (sqlc.arg('include_deleted')::boolean OR deleted_at IS NULL)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
@@ -0,0 +1,87 @@
+-- name: EnqueueJob :execrows
+INSERT INTO jobs (id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, unique_key)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    'pending',
+    0,
+    $3,
+    $4,
+    $5
+)
+ON CONFLICT DO NOTHING;
+
+-- name: ClaimJobs :many
+-- Running jobs whose lock has lapsed belong to a worker that died, so they
+-- are claimed again.
+UPDATE jobs SET status = 'running',
+attempts = attempts + 1,
+locked_until = sqlc.arg('locked_until'),
+locked_by = sqlc.arg('locked_by'),
+updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM jobs
+    WHERE (status = 'pending' AND run_at <= NOW())
+    OR (status = 'running' AND locked_until < NOW())
+    ORDER BY run_at ASC
+    LIMIT sqlc.arg('row_limit')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: DeleteJob :execrows
+-- DeleteJob, RetryJob and KillJob only touch a job whose lease the worker
+-- still holds. No rows means the lease lapsed and the job may have been
+-- claimed again.
+DELETE FROM jobs
+WHERE id = $1
+AND locked_by = $2
+AND locked_until > NOW();
+
+-- name: RetryJob :execrows
+UPDATE jobs SET status = 'pending',
+run_at = $2,
+locked_until = NULL,
+locked_by = NULL,
+last_error = $3,
+updated_at = NOW()
+WHERE id = $1
+AND locked_by = $4
+AND locked_until > NOW();
+
+-- name: KillJob :execrows
+UPDATE jobs SET status = 'dead',
+locked_until = NULL,
+locked_by = NULL,
+last_error = $2,
+updated_at = NOW()
+WHERE id = $1
+AND locked_by = $3
+AND locked_until > NOW();
+
+-- name: RequeueDeadJob :execrows
+UPDATE jobs SET status = 'pending',
+attempts = 0,
+run_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+AND status = 'dead';
+
+-- name: ListJobs :many
+SELECT *
+FROM jobs
+WHERE status = sqlc.arg('status')
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: PurgeDeadJobs :execrows
+DELETE FROM jobs
+WHERE status = 'dead'
+AND updated_at < $1;
@@ -0,0 +1,27 @@
+-- name: GetLoginThrottle :one
+SELECT * FROM login_throttles
+WHERE scope = $1 AND subject = $2;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (scope, subject, failures, last_failed_at)
+VALUES (
+    sqlc.arg(scope),
+    sqlc.arg(subject),
+    1,
+    NOW()
+)
+ON CONFLICT (scope, subject) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failed_at < sqlc.arg(reset_before) THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failed_at = NOW()
+RETURNING failures;
+
+-- name: SetLoginThrottleLockedUntil :exec
+UPDATE login_throttles SET locked_until = $3
+WHERE scope = $1 AND subject = $2;
+
+-- name: DeleteLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE scope = $1 AND subject = $2;
@@ -0,0 +1,20 @@
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id, created_at, moderator_id, action, target_user_id, target_chirp_id, chirp_body, reason)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: ListModerationActionsForUser :many
+SELECT *
+FROM moderation_actions
+WHERE target_user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
@@ -0,0 +1,9 @@
+-- name: MarkWebhookEventProcessed :execrows
+INSERT INTO processed_webhook_events (source, event_id, event_type, processed_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+ON CONFLICT (source, event_id) DO NOTHING;
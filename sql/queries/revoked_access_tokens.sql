@@ -0,0 +1,18 @@
+-- name: CreateRevokedAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, user_id, expires_at, revoked_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: ListActiveRevokedAccessTokens :many
+SELECT jti, expires_at
+FROM revoked_access_tokens
+WHERE expires_at > NOW();
+
+-- name: DeleteExpiredRevokedAccessTokens :exec
+DELETE FROM revoked_access_tokens
+WHERE expires_at <= NOW();
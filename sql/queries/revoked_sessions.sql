@@ -0,0 +1,18 @@
+-- name: CreateRevokedSession :exec
+INSERT INTO revoked_sessions (session_id, user_id, expires_at, revoked_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+ON CONFLICT (session_id) DO NOTHING;
+
+-- name: ListActiveRevokedSessions :many
+SELECT session_id, expires_at
+FROM revoked_sessions
+WHERE expires_at > NOW();
+
+-- name: DeleteExpiredRevokedSessions :exec
+DELETE FROM revoked_sessions
+WHERE expires_at <= NOW();
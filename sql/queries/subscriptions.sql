@@ -0,0 +1,57 @@
+-- name: GetSubscription :one
+SELECT *
+FROM subscriptions
+WHERE user_id = $1;
+
+-- name: GetSubscriptionForUpdate :one
+SELECT *
+FROM subscriptions
+WHERE user_id = $1
+FOR UPDATE;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (user_id, status, current_period_end, created_at, updated_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET status = EXCLUDED.status,
+    current_period_end = EXCLUDED.current_period_end,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: ExpireSubscriptions :many
+UPDATE subscriptions SET status = 'expired', updated_at = NOW()
+WHERE status IN ('active', 'canceled')
+AND current_period_end <= NOW()
+RETURNING *;
+
+-- name: IsChirpyRed :one
+SELECT EXISTS (
+    SELECT 1 FROM subscriptions
+    WHERE user_id = $1
+    AND status IN ('active', 'canceled')
+    AND current_period_end > NOW()
+);
+
+-- name: CreateSubscriptionEvent :exec
+INSERT INTO subscription_events (id, user_id, event_type, status, current_period_end, webhook_event_id, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW()
+);
+
+-- name: ListSubscriptionEventsForUser :many
+SELECT *
+FROM subscription_events
+WHERE user_id = $1
+ORDER BY created_at DESC;
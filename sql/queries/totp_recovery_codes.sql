@@ -0,0 +1,19 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO totp_recovery_codes (id, user_id, code_hash, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW()
+);
+
+-- name: UseRecoveryCode :one
+UPDATE totp_recovery_codes SET used_at = NOW()
+WHERE user_id = $1
+AND code_hash = $2
+AND used_at IS NULL
+RETURNING *;
+
+-- name: DeleteRecoveryCodesForUser :exec
+DELETE FROM totp_recovery_codes
+WHERE user_id = $1;
@@ -23,7 +23,73 @@ FROM users
 WHERE email = $1;
 
 -- name: UpdateUser :one
-UPDATE users SET email = $2, hashed_password = $3, updated_at = NOW()
+UPDATE users SET email = $2, hashed_password = $3, updated_at = NOW(),
+email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END
 WHERE id = $1
 RETURNING *;
 
+-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserByID :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+-- name: MarkEmailVerified :one
+UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetPendingTOTPSecret :one
+UPDATE users SET totp_secret = $2, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: EnableTOTP :one
+UPDATE users SET totp_enabled_at = NOW(), updated_at = NOW()
+WHERE id = $1
+AND totp_secret IS NOT NULL
+RETURNING *;
+
+-- name: DisableTOTP :exec
+UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetTokensValidAfter :one
+UPDATE users SET tokens_valid_after = NOW(), updated_at = NOW()
+WHERE id = $1
+RETURNING tokens_valid_after;
+
+-- name: ListRecentTokensValidAfter :many
+SELECT id, tokens_valid_after
+FROM users
+WHERE tokens_valid_after > $1;
+
+-- name: SetUserRole :one
+UPDATE users SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CountUsersWithRole :one
+SELECT COUNT(*)
+FROM users
+WHERE role = $1;
+
+-- name: SuspendUser :one
+UPDATE users SET suspended_at = COALESCE(suspended_at, NOW()), updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UnsuspendUser :one
+UPDATE users SET suspended_at = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UseTOTPStep :execrows
+-- UseTOTPStep records step as used. It affects no rows when a code from that
+-- step or a later one was already accepted.
+UPDATE users SET totp_last_step = sqlc.arg('step')::bigint
+WHERE id = sqlc.arg('id')
+AND (totp_last_step IS NULL OR totp_last_step < sqlc.arg('step')::bigint);
@@ -0,0 +1,48 @@
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, created_at, updated_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    'pending',
+    0,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT *
+FROM webhook_deliveries
+WHERE id = $1;
+
+-- name: RecordWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries SET status = $2,
+attempts = attempts + 1,
+next_attempt_at = $3,
+last_attempt_at = NOW(),
+response_status = $4,
+last_error = $5,
+updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetWebhookDeliveryForEndpoint :one
+SELECT *
+FROM webhook_deliveries
+WHERE id = $1
+AND endpoint_id = $2;
+
+-- name: ListWebhookDeliveriesForEndpoint :many
+SELECT *
+FROM webhook_deliveries
+WHERE endpoint_id = sqlc.arg('endpoint_id')
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
@@ -0,0 +1,40 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, events)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT *
+FROM webhook_endpoints
+WHERE id = $1;
+
+-- name: GetWebhookEndpointForUser :one
+SELECT *
+FROM webhook_endpoints
+WHERE id = $1
+AND user_id = $2;
+
+-- name: ListWebhookEndpointsForUser :many
+SELECT *
+FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListWebhookEndpointsForEvent :many
+SELECT *
+FROM webhook_endpoints
+WHERE user_id = sqlc.arg('user_id')
+AND sqlc.arg('event_type')::text = ANY(events);
+
+-- name: DeleteWebhookEndpointForUser :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1
+AND user_id = $2;
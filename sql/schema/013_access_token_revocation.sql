@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN tokens_valid_after TIMESTAMP;
+
+CREATE TABLE revoked_access_tokens (
+    jti TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_revoked_access_tokens_expires_at ON revoked_access_tokens (expires_at);
+CREATE INDEX idx_users_tokens_valid_after ON users (tokens_valid_after)
+WHERE tokens_valid_after IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_users_tokens_valid_after;
+DROP TABLE revoked_access_tokens;
+
+ALTER TABLE users
+DROP COLUMN tokens_valid_after;
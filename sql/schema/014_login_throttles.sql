@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE login_throttles (
+    scope TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failed_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    PRIMARY KEY (scope, subject)
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN suspended_at TIMESTAMP;
+
+CREATE TABLE moderation_actions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    moderator_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    target_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    target_chirp_id UUID,
+    chirp_body TEXT,
+    reason TEXT NOT NULL
+);
+
+CREATE INDEX idx_moderation_actions_target_user ON moderation_actions (target_user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE moderation_actions;
+
+ALTER TABLE users
+DROP COLUMN suspended_at;
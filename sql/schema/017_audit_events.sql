@@ -0,0 +1,22 @@
+-- +goose Up
+-- actor_id and subject_id deliberately have no foreign keys: the log has to
+-- outlive the users it mentions.
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    event_type TEXT NOT NULL,
+    actor_id UUID,
+    subject_id UUID,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    metadata JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX idx_audit_events_created_at ON audit_events (created_at DESC, id DESC);
+CREATE INDEX idx_audit_events_event_type ON audit_events (event_type, created_at DESC);
+CREATE INDEX idx_audit_events_actor_id ON audit_events (actor_id, created_at DESC);
+CREATE INDEX idx_audit_events_subject_id ON audit_events (subject_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE audit_events;
@@ -0,0 +1,55 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('active', 'canceled', 'expired', 'refunded')),
+    current_period_end TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_subscriptions_expiring ON subscriptions (current_period_end)
+WHERE status IN ('active', 'canceled');
+
+CREATE TABLE subscription_events (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    webhook_event_id TEXT,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_subscription_events_user_id ON subscription_events (user_id, created_at DESC);
+
+-- Chirpy Red used to be a flag with no end date. Existing members get one
+-- DefaultPeriod (30 days) from the migration, recorded as a 'migrated'
+-- event. This is deliberate: we have no record of what they paid for, so
+-- Polka's next user.renewed or user.upgraded for them extends it, and a
+-- member Polka sends nothing for lapses like any other subscription rather
+-- than keeping Red forever.
+INSERT INTO subscriptions (user_id, status, current_period_end, created_at, updated_at)
+SELECT id, 'active', NOW() + INTERVAL '30 days', NOW(), NOW()
+FROM users
+WHERE is_chirpy_red;
+
+INSERT INTO subscription_events (id, user_id, event_type, status, current_period_end, created_at)
+SELECT gen_random_uuid(), user_id, 'migrated', status, current_period_end, NOW()
+FROM subscriptions;
+
+ALTER TABLE users
+DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users
+ADD COLUMN is_chirpy_red BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE users SET is_chirpy_red = true
+WHERE id IN (
+    SELECT user_id FROM subscriptions
+    WHERE status IN ('active', 'canceled')
+    AND current_period_end > NOW()
+);
+
+DROP TABLE subscription_events;
+DROP TABLE subscriptions;
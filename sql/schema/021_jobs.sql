@@ -0,0 +1,41 @@
+-- +goose Up
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    -- Finished jobs are deleted; dead ones are kept until purged so they can
+    -- be inspected and retried.
+    status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL,
+    run_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    last_error TEXT,
+    unique_key TEXT
+);
+
+CREATE INDEX idx_jobs_due ON jobs (run_at) WHERE status IN ('pending', 'running');
+CREATE INDEX idx_jobs_status ON jobs (status, created_at DESC, id DESC);
+-- At most one live job per key, so every server can schedule the same
+-- periodic job without it running several times over.
+CREATE UNIQUE INDEX idx_jobs_unique_key ON jobs (unique_key)
+WHERE unique_key IS NOT NULL AND status IN ('pending', 'running');
+
+-- Webhook deliveries are driven by jobs now rather than by polling, so
+-- deliveries still pending need a job each or they'd never be attempted.
+-- The payload and max_attempts match what queueWebhookDelivery enqueues.
+INSERT INTO jobs (id, created_at, updated_at, kind, payload, status, max_attempts, run_at)
+SELECT gen_random_uuid(), NOW(), NOW(), 'deliver_webhook',
+    jsonb_build_object('delivery_id', id), 'pending', 5, next_attempt_at
+FROM webhook_deliveries
+WHERE status = 'pending';
+
+DROP INDEX idx_webhook_deliveries_due;
+
+-- +goose Down
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at)
+WHERE status = 'pending';
+
+DROP TABLE jobs;
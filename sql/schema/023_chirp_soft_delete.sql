@@ -0,0 +1,15 @@
+-- +goose Up
+-- Deleted chirps stay as tombstones until purged so they can be restored.
+-- deleted_by is whoever deleted it: the author or a moderator.
+ALTER TABLE chirps
+ADD COLUMN deleted_at TIMESTAMP,
+ADD COLUMN deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_chirps_deleted_at ON chirps (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_chirps_deleted_at;
+
+ALTER TABLE chirps
+DROP COLUMN deleted_by,
+DROP COLUMN deleted_at;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- A reply keeps pointing at a soft-deleted parent; only purging the parent
+-- detaches it.
+ALTER TABLE chirps
+ADD COLUMN in_reply_to UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_chirps_in_reply_to ON chirps (in_reply_to, created_at, id) WHERE in_reply_to IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_chirps_in_reply_to;
+
+ALTER TABLE chirps
+DROP COLUMN in_reply_to;
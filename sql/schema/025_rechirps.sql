@@ -0,0 +1,34 @@
+-- +goose Up
+-- A rechirp reposts rechirp_of as is and has no body of its own. A quote has
+-- its own body and embeds quote_of. Purging the original takes its rechirps
+-- with it but leaves quotes standing without the embed.
+ALTER TABLE chirps
+ADD COLUMN kind TEXT NOT NULL DEFAULT 'post',
+ADD COLUMN rechirp_of UUID REFERENCES chirps(id) ON DELETE CASCADE,
+ADD COLUMN quote_of UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD CONSTRAINT chirps_kind_check CHECK (kind IN ('post', 'rechirp', 'quote')),
+ADD CONSTRAINT chirps_rechirp_of_check CHECK ((kind = 'rechirp') = (rechirp_of IS NOT NULL)),
+ADD CONSTRAINT chirps_rechirp_reply_check CHECK (kind <> 'rechirp' OR in_reply_to IS NULL),
+ADD CONSTRAINT chirps_quote_of_check CHECK (kind = 'quote' OR quote_of IS NULL);
+
+-- One rechirp per user per chirp, and no accidental double quotes.
+CREATE UNIQUE INDEX idx_chirps_rechirp_unique ON chirps (user_id, rechirp_of) WHERE kind = 'rechirp';
+CREATE UNIQUE INDEX idx_chirps_quote_unique ON chirps (user_id, quote_of, body) WHERE kind = 'quote' AND deleted_at IS NULL;
+
+CREATE INDEX idx_chirps_rechirp_of ON chirps (rechirp_of) WHERE rechirp_of IS NOT NULL;
+CREATE INDEX idx_chirps_quote_of ON chirps (quote_of) WHERE quote_of IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_chirps_quote_of;
+DROP INDEX idx_chirps_rechirp_of;
+DROP INDEX idx_chirps_quote_unique;
+DROP INDEX idx_chirps_rechirp_unique;
+
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_quote_of_check,
+DROP CONSTRAINT chirps_rechirp_reply_check,
+DROP CONSTRAINT chirps_rechirp_of_check,
+DROP CONSTRAINT chirps_kind_check,
+DROP COLUMN quote_of,
+DROP COLUMN rechirp_of,
+DROP COLUMN kind;
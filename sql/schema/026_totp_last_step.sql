@@ -0,0 +1,9 @@
+-- +goose Up
+-- The TOTP time step of the last code accepted at login, so the same code
+-- can't be replayed while it is still valid.
+ALTER TABLE users
+ADD COLUMN totp_last_step BIGINT;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN totp_last_step;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Access tokens carry their session in `sid`. A revoked session stays listed
+-- until the last access token issued from it has expired.
+CREATE TABLE revoked_sessions (
+    session_id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_revoked_sessions_expires_at ON revoked_sessions (expires_at);
+
+-- +goose Down
+DROP TABLE revoked_sessions;
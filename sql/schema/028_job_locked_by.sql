@@ -0,0 +1,9 @@
+-- +goose Up
+-- The worker holding a running job's lease. Only that worker may finish the
+-- job, and only while the lease lasts.
+ALTER TABLE jobs
+ADD COLUMN locked_by TEXT;
+
+-- +goose Down
+ALTER TABLE jobs
+DROP COLUMN locked_by;